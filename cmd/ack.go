@@ -1,23 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
-var (
-	ackServer string
-	ackAll    bool
-)
+var ackAll bool
 
 func init() {
-	ackCmd.Flags().StringVar(&ackServer, "server", "", "pidge server URL (default: derived from webhook_url or http://localhost:3851)")
 	ackCmd.Flags().BoolVar(&ackAll, "all", false, "mark all messages as processed")
 	rootCmd.AddCommand(ackCmd)
 }
@@ -25,9 +20,10 @@ func init() {
 var ackCmd = &cobra.Command{
 	Use:   "ack [id]",
 	Short: "Mark a message as processed",
-	Long:  "Mark a received message (or all messages with --all) as processed on the pidge server.",
-	Args:  cobra.MaximumNArgs(1),
-	RunE:  runAck,
+	Long: "Mark a received message (or all messages with --all) as processed, through the pidge server\n" +
+		"if it's answering, otherwise directly in the database.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: runAck,
 }
 
 func runAck(cmd *cobra.Command, args []string) error {
@@ -35,82 +31,54 @@ func runAck(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("provide a message id or use --all")
 	}
 
-	base, err := resolveServerURL(ackServer)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ib, err := openInbox(ctx)
 	if err != nil {
 		return err
 	}
-
-	client := &http.Client{Timeout: 10 * time.Second}
+	defer ib.Close()
 
 	if ackAll {
-		endpoint := fmt.Sprintf("%s/api/messages/processed", strings.TrimRight(base, "/"))
-		resp, err := client.Post(endpoint, "", nil)
+		n, err := ib.AckAll(ctx)
 		if err != nil {
-			return fmt.Errorf("reaching pidge server: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
+			return err
 		}
 
 		if jsonOutput {
-			body, _ := io.ReadAll(resp.Body)
-			fmt.Println(string(body))
-			return nil
+			return printJSON(map[string]any{"status": "ok", "count": n})
 		}
 
 		fmt.Println("All messages marked as processed.")
 		return nil
 	}
 
-	id := args[0]
-	endpoint := fmt.Sprintf("%s/api/messages/%s/processed", strings.TrimRight(base, "/"), id)
-
-	resp, err := client.Post(endpoint, "", nil)
+	id, err := parseMessageID(args[0])
 	if err != nil {
-		return fmt.Errorf("reaching pidge server: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("message %s not found", id)
-	}
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
+	if err := ib.Ack(ctx, id); err != nil {
+		if errors.Is(err, errNotFound) {
+			return fmt.Errorf("message %d not found", id)
+		}
+		return err
 	}
 
 	if jsonOutput {
-		return printJSON(map[string]string{"status": "ok", "id": id})
+		return printJSON(map[string]string{"status": "ok", "id": args[0]})
 	}
 
-	fmt.Printf("Message %s marked as processed.\n", id)
+	fmt.Printf("Message %d marked as processed.\n", id)
 	return nil
 }
 
-// resolveServerURL determines the pidge server base URL from an explicit
-// override, the webhook_url config, or the listen address.
-func resolveServerURL(override string) (string, error) {
-	if override != "" {
-		return override, nil
-	}
-
-	if cfg.Server.WebhookURL != "" {
-		u, err := url.Parse(cfg.Server.WebhookURL)
-		if err == nil && u.Host != "" {
-			return fmt.Sprintf("%s://%s", u.Scheme, u.Host), nil
-		}
-	}
-
-	listen := cfg.Server.Listen
-	if listen == "" {
-		listen = ":3851"
-	}
-	host := listen
-	if strings.HasPrefix(host, ":") {
-		host = "localhost" + host
+// parseMessageID parses a received message's database ID from the command line.
+func parseMessageID(s string) (int64, error) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid message id %q", s)
 	}
-	return "http://" + host, nil
+	return id, nil
 }
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/typhonius/pidge/internal/store"
+	"github.com/typhonius/pidge/pidgeclient"
+)
+
+// pingTimeout bounds the check for a running local server.
+const pingTimeout = 2 * time.Second
+
+// errNotFound is returned by an inbox for a message ID that doesn't exist.
+var errNotFound = errors.New("not found")
+
+// inbox is where inbox-management commands read and update received
+// messages: a pidge server's API, or the database directly.
+type inbox interface {
+	ListMessages(ctx context.Context, f store.ListFilter) ([]store.ReceivedMessage, error)
+	Ack(ctx context.Context, id int64) error
+	Unack(ctx context.Context, id int64) error
+	AckAll(ctx context.Context) (int64, error)
+	Close() error
+}
+
+// openInbox returns the remote server's inbox in remote mode. Otherwise it
+// uses the local server if one answers, so there's a single writer, and
+// falls back to the database when it doesn't.
+func openInbox(ctx context.Context) (inbox, error) {
+	if pc := remoteClient(); pc != nil {
+		return remoteInbox{pc}, nil
+	}
+
+	url := localServerURL(cfg)
+	pc := pidgeclient.New(url)
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	pingErr := pc.Ping(pingCtx)
+	if pingErr == nil {
+		return remoteInbox{pc}, nil
+	}
+
+	dbPath := cfg.ExpandDBPath()
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("no pidge server answering at %s (%v) and no message store at %s — is 'pidge serve' running?", url, pingErr, dbPath)
+	}
+	st, err := openStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return localInbox{st}, nil
+}
+
+// remoteInbox manages messages through a pidge server.
+type remoteInbox struct {
+	pc *pidgeclient.Client
+}
+
+func (r remoteInbox) ListMessages(ctx context.Context, f store.ListFilter) ([]store.ReceivedMessage, error) {
+	list, err := r.pc.ListMessages(ctx, pidgeclient.ListFilter{
+		Phone:     f.Phone,
+		DeviceID:  f.DeviceID,
+		SimNumber: f.SimNumber,
+		Since:     f.Since,
+		Before:    f.Before,
+		Processed: f.Processed,
+		Limit:     f.Limit,
+		Offset:    f.Offset,
+		Ascending: f.Ascending,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing messages on %s: %w", r.pc.BaseURL(), err)
+	}
+	messages := make([]store.ReceivedMessage, len(list))
+	for i, m := range list {
+		messages[i] = receivedMessage(m)
+	}
+	return messages, nil
+}
+
+func (r remoteInbox) Ack(ctx context.Context, id int64) error {
+	return remoteErr(r.pc.Ack(ctx, id))
+}
+
+func (r remoteInbox) Unack(ctx context.Context, id int64) error {
+	return remoteErr(r.pc.Unack(ctx, id))
+}
+
+func (r remoteInbox) AckAll(ctx context.Context) (int64, error) {
+	return r.pc.AckAll(ctx)
+}
+
+func (r remoteInbox) Close() error { return nil }
+
+func remoteErr(err error) error {
+	if errors.Is(err, pidgeclient.ErrNotFound) {
+		return errNotFound
+	}
+	return err
+}
+
+// localInbox manages messages in the database directly.
+type localInbox struct {
+	st *store.Store
+}
+
+func (l localInbox) ListMessages(ctx context.Context, f store.ListFilter) ([]store.ReceivedMessage, error) {
+	messages, err := l.st.ListMessages(f)
+	if err != nil {
+		return nil, fmt.Errorf("listing messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (l localInbox) Ack(ctx context.Context, id int64) error {
+	return localErr(l.st.MarkProcessed(id))
+}
+
+func (l localInbox) Unack(ctx context.Context, id int64) error {
+	return localErr(l.st.MarkUnprocessed(id))
+}
+
+func (l localInbox) AckAll(ctx context.Context) (int64, error) {
+	return l.st.MarkAllProcessed()
+}
+
+func (l localInbox) Close() error { return l.st.Close() }
+
+func localErr(err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return errNotFound
+	}
+	return err
+}
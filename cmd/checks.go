@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Check statuses, from best to worst.
+const (
+	checkPass = "pass"
+	checkSkip = "skip"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// checkResult is one line of a diagnostic report.
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// checkReport collects check results in order.
+type checkReport struct {
+	Checks []checkResult `json:"checks"`
+}
+
+func (r *checkReport) add(name, status, format string, args ...any) {
+	r.Checks = append(r.Checks, checkResult{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+// failed returns the first failed check, or nil.
+func (r *checkReport) failed() *checkResult {
+	for i := range r.Checks {
+		if r.Checks[i].Status == checkFail {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+// worst returns the most severe status in the report.
+func (r *checkReport) worst() string {
+	rank := map[string]int{checkPass: 0, checkSkip: 0, checkWarn: 1, checkFail: 2}
+	worst := checkPass
+	for _, c := range r.Checks {
+		if rank[c.Status] > rank[worst] {
+			worst = c.Status
+		}
+	}
+	return worst
+}
+
+func (r *checkReport) print() {
+	width := 0
+	for _, c := range r.Checks {
+		width = max(width, len(c.Name))
+	}
+	for _, c := range r.Checks {
+		fmt.Printf("%-4s  %-*s  %s\n", strings.ToUpper(c.Status), width, c.Name, c.Detail)
+	}
+}
+
+// roughDuration formats d in days, or hours when under two days.
+func roughDuration(d time.Duration) string {
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
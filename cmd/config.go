@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/config"
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPathCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "View, validate and edit configuration",
+	// The config commands load the file themselves so they work when it is
+	// missing or invalid.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration and where each value comes from",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigShow,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a value in the config file",
+	Long:  "Set a value in the config file, e.g. 'pidge config set server.listen :4000'.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runConfigSet,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration for problems",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigValidate,
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the config file path",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigPath,
+}
+
+// configValue is a row of 'pidge config show'.
+type configValue struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	path, err := resolveConfigPath()
+	if err != nil {
+		return err
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	var rows []configValue
+	for _, f := range c.Fields() {
+		v := f.String()
+		if f.Secret && !f.IsZero() {
+			v = maskSecret(v)
+		}
+		rows = append(rows, configValue{Key: f.Key, Value: v, Source: c.Source(f)})
+	}
+
+	if jsonOutput {
+		return printJSON(rows)
+	}
+
+	fmt.Printf("# %s\n", path)
+	for _, r := range rows {
+		v := r.Value
+		if v == "" {
+			v = `""`
+		}
+		fmt.Printf("%-32s %-40s %s\n", r.Key, v, r.Source)
+	}
+	return nil
+}
+
+func maskSecret(v string) string {
+	if strings.HasPrefix(v, "[") {
+		return v // slice summary, e.g. "[2 entries]"
+	}
+	return "********"
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	path, err := resolveConfigPath()
+	if err != nil {
+		return err
+	}
+
+	// Edit the file as written so defaults and env overrides aren't persisted.
+	c, err := config.LoadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		c = &config.Config{}
+	}
+
+	f, err := c.Field(args[0])
+	if err != nil {
+		return err
+	}
+	if err := f.Set(args[1]); err != nil {
+		return err
+	}
+	if err := c.Save(path); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]string{"key": f.Key, "value": f.String(), "config": path})
+	}
+
+	fmt.Printf("Set %s = %s in %s\n", f.Key, f.String(), path)
+	return nil
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	path, err := resolveConfigPath()
+	if err != nil {
+		return err
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	problems := c.Check()
+	if jsonOutput {
+		if problems == nil {
+			problems = []config.FieldError{}
+		}
+		if err := printJSON(map[string]any{"valid": len(problems) == 0, "errors": problems}); err != nil {
+			return err
+		}
+	} else if len(problems) == 0 {
+		fmt.Printf("%s is valid.\n", path)
+	} else {
+		for _, p := range problems {
+			fmt.Printf("  %-28s %s\n", p.Key, p.Message)
+		}
+	}
+
+	if len(problems) > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d problem(s) in %s", len(problems), path)
+	}
+	return nil
+}
+
+func runConfigPath(cmd *cobra.Command, args []string) error {
+	path, err := resolveConfigPath()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		_, statErr := os.Stat(path)
+		return printJSON(map[string]any{"path": path, "exists": statErr == nil})
+	}
+	fmt.Println(path)
+	return nil
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/store"
+)
+
+var rekeyNewKeyFile string
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbKeygenCmd)
+	dbCmd.AddCommand(dbEncryptCmd)
+	dbCmd.AddCommand(dbRekeyCmd)
+
+	dbRekeyCmd.Flags().StringVar(&rekeyNewKeyFile, "new-key-file", "", "file containing the new key (required)")
+	dbRekeyCmd.MarkFlagRequired("new-key-file")
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the message database",
+}
+
+var dbKeygenCmd = &cobra.Command{
+	Use:   "keygen <file>",
+	Short: "Generate a database encryption key file",
+	Long:  "Write a new random key to <file> for use as db_key_file. The file must not already exist.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDBKeygen,
+}
+
+var dbEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt existing messages at rest",
+	Long: "Encrypt message bodies and phone numbers already stored in plaintext, using the key from\n" +
+		"db_key_file or PIDGE_DB_KEY. Stop 'pidge serve' first.",
+	Args: cobra.NoArgs,
+	RunE: runDBEncrypt,
+}
+
+var dbRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Change the database encryption key",
+	Long: "Re-wrap the database's data key with the key in --new-key-file. Messages are not re-encrypted,\n" +
+		"so this is quick. Afterwards point db_key_file (or PIDGE_DB_KEY) at the new key.",
+	Args: cobra.NoArgs,
+	RunE: runDBRekey,
+}
+
+// openStore opens the message store at path with the configured at-rest
+// encryption key, if any.
+func openStore(path string) (*store.Store, error) {
+	key, err := dbKey()
+	if err != nil {
+		return nil, err
+	}
+	st, err := store.Open(path, key)
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	return st, nil
+}
+
+// openStoreReadOnly opens an existing message store at path without writing
+// to it, for commands that only inspect it.
+func openStoreReadOnly(path string) (*store.Store, error) {
+	key, err := dbKey()
+	if err != nil {
+		return nil, err
+	}
+	st, err := store.OpenReadOnly(path, key)
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	return st, nil
+}
+
+func dbKey() ([]byte, error) {
+	encoded, err := cfg.DBKey()
+	if err != nil || encoded == "" {
+		return nil, err
+	}
+	key, err := store.ParseKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("database key: %w", err)
+	}
+	return key, nil
+}
+
+func runDBKeygen(cmd *cobra.Command, args []string) error {
+	path := expandHome(args[0])
+	key, err := store.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating key directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("creating key file: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, key); err != nil {
+		return fmt.Errorf("writing key file: %w", err)
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]string{"keyFile": path})
+	}
+
+	fmt.Printf("Key written to %s\n", path)
+	fmt.Println("Back it up: messages encrypted with it cannot be recovered without it.")
+	return nil
+}
+
+func runDBEncrypt(cmd *cobra.Command, args []string) error {
+	key, err := dbKey()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return fmt.Errorf("no key configured; run 'pidge db keygen <file>' and set db_key_file")
+	}
+
+	st, err := openStore(cfg.ExpandDBPath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	n, err := st.EncryptExisting()
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]any{"status": "ok", "encrypted": n})
+	}
+
+	fmt.Printf("Encrypted %d message(s).\n", n)
+	return nil
+}
+
+func runDBRekey(cmd *cobra.Command, args []string) error {
+	b, err := os.ReadFile(expandHome(rekeyNewKeyFile))
+	if err != nil {
+		return fmt.Errorf("reading new key: %w", err)
+	}
+	newKey, err := store.ParseKey(string(b))
+	if err != nil {
+		return fmt.Errorf("new key: %w", err)
+	}
+
+	st, err := openStore(cfg.ExpandDBPath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	if !st.Encrypted() {
+		return fmt.Errorf("no current key configured; use 'pidge db encrypt' for an unencrypted database")
+	}
+	if err := st.Rekey(newKey); err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]string{"status": "ok", "keyFile": rekeyNewKeyFile})
+	}
+
+	fmt.Println("Database rekeyed. Set db_key_file to the new key file before restarting 'pidge serve'.")
+	return nil
+}
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/config"
+	"github.com/typhonius/pidge/internal/control"
+	"github.com/typhonius/pidge/internal/store"
+)
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common setup problems",
+	Long: "Check the config, gateway connection, database, TLS certificate, listen port, webhook\n" +
+		"registration and webhook secret, and report each as pass, warn or fail.",
+	Args: cobra.NoArgs,
+	// Load the config here so an invalid one is reported, not fatal.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return checkRemoteServer(cmd) },
+	RunE:              runDoctor,
+}
+
+// certExpiryWarning is how close to expiry a certificate must be to warn.
+const certExpiryWarning = 14 * 24 * time.Hour
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	report := &checkReport{}
+	diagnose(report)
+
+	if jsonOutput {
+		if err := printJSON(map[string]any{"status": report.worst(), "checks": report.Checks}); err != nil {
+			return err
+		}
+	} else {
+		report.print()
+	}
+
+	if report.failed() != nil {
+		cmd.SilenceUsage = true
+		return errors.New("problems found")
+	}
+	return nil
+}
+
+func diagnose(report *checkReport) {
+	path, err := resolveConfigPath()
+	if err != nil {
+		report.add("config", checkFail, "%v", err)
+		return
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			report.add("config", checkFail, "%s not found; run 'pidge setup'", path)
+		} else {
+			report.add("config", checkFail, "%v", err)
+		}
+		return
+	}
+	cfg = c
+	// Without a URL the client would fall back to the public cloud server
+	// and send it empty credentials.
+	if c.Gateway.URL != "" {
+		client = newGatewayClient(c)
+	}
+
+	if problems := c.Check(); len(problems) > 0 {
+		for _, p := range problems {
+			report.add("config", checkFail, "%s", p)
+		}
+	} else {
+		report.add("config", checkPass, "%s is valid", path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	checkGateway(ctx, report)
+	checkDatabase(report)
+	checkCertificate(report)
+	checkListener(report)
+	checkWebhooks(ctx, report)
+	checkSecret(report)
+}
+
+func checkGateway(ctx context.Context, report *checkReport) {
+	if cfg.Gateway.URL == "" {
+		report.add("gateway", checkSkip, "gateway.url is not set")
+		return
+	}
+	health, err := client.CheckHealth(ctx)
+	if err != nil {
+		report.add("gateway", checkFail, "%s: %v", cfg.Gateway.URL, err)
+		return
+	}
+	switch health.Status {
+	case "pass":
+		report.add("gateway", checkPass, "%s is healthy (version %s)", cfg.Gateway.URL, health.Version)
+	case "warn":
+		report.add("gateway", checkWarn, "%s reports warnings; see 'pidge health'", cfg.Gateway.URL)
+	default:
+		report.add("gateway", checkFail, "%s reports status %q; see 'pidge health'", cfg.Gateway.URL, health.Status)
+	}
+}
+
+func checkDatabase(report *checkReport) {
+	path := cfg.ExpandDBPath()
+	version, err := store.ReadVersion(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		report.add("database", checkWarn, "%s does not exist yet; 'pidge serve' creates it", path)
+		return
+	case err != nil:
+		report.add("database", checkFail, "%s: %v", path, err)
+		return
+	case version > store.SchemaVersion:
+		report.add("database", checkFail, "%s has schema version %d, newer than this pidge (%d)", path, version, store.SchemaVersion)
+		return
+	case version < store.SchemaVersion:
+		report.add("database", checkWarn, "%s has schema version %d; it will be upgraded to %d on next open", path, version, store.SchemaVersion)
+		return
+	}
+
+	st, err := openStoreReadOnly(path)
+	if err != nil {
+		report.add("database", checkFail, "%v", err)
+		return
+	}
+	defer st.Close()
+	stats, err := st.Stats()
+	if err != nil {
+		report.add("database", checkFail, "%v", err)
+		return
+	}
+	report.add("database", checkPass, "%s opens at schema version %d (%d messages, %d unprocessed)",
+		path, version, stats.Total, stats.Unprocessed)
+}
+
+func checkCertificate(report *checkReport) {
+	certFile := expandHome(cfg.Server.TLSCert)
+	keyFile := expandHome(cfg.Server.TLSKey)
+	if certFile == "" || keyFile == "" {
+		report.add("tls", checkSkip, "tls_cert/tls_key not set; serving plain HTTP")
+		return
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		report.add("tls", checkFail, "%v", err)
+		return
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		report.add("tls", checkFail, "parsing %s: %v", certFile, err)
+		return
+	}
+
+	if u, err := url.Parse(cfg.Server.WebhookURL); err == nil && u.Hostname() != "" {
+		if err := leaf.VerifyHostname(u.Hostname()); err != nil {
+			report.add("tls", checkFail, "certificate is not valid for webhook_url host %s", u.Hostname())
+			return
+		}
+	}
+
+	left := time.Until(leaf.NotAfter)
+	switch {
+	case left <= 0:
+		report.add("tls", checkFail, "certificate expired %s", leaf.NotAfter.Format(time.RFC3339))
+	case left < certExpiryWarning:
+		report.add("tls", checkWarn, "certificate expires in %s", roughDuration(left))
+	default:
+		report.add("tls", checkPass, "key matches certificate, valid until %s", leaf.NotAfter.Format("2006-01-02"))
+	}
+}
+
+func checkListener(report *checkReport) {
+	dbPath := cfg.ExpandDBPath()
+	resp, err := control.Call(dbPath, control.Request{Command: control.CmdStatus})
+	if err == nil {
+		var status serveStatus
+		json.Unmarshal(resp.Status, &status)
+		report.add("listen", checkPass, "pidge serve (pid %d) is listening on %s", status.PID, status.Listen)
+		return
+	}
+
+	ln, err := net.Listen("tcp", cfg.Server.Listen)
+	if err == nil {
+		ln.Close()
+		report.add("listen", checkWarn, "nothing is listening on %s; start 'pidge serve'", cfg.Server.Listen)
+		return
+	}
+	if errors.Is(err, syscall.EADDRINUSE) {
+		report.add("listen", checkFail, "%s is in use by another process; pidge serve for %s isn't running", cfg.Server.Listen, dbPath)
+		return
+	}
+	report.add("listen", checkFail, "cannot listen on %s: %v", cfg.Server.Listen, err)
+}
+
+func checkWebhooks(ctx context.Context, report *checkReport) {
+	if cfg.Server.WebhookURL == "" {
+		report.add("webhooks", checkWarn, "webhook_url is not set; the gateway can't deliver incoming SMS")
+		return
+	}
+	if cfg.Gateway.URL == "" {
+		report.add("webhooks", checkSkip, "gateway.url is not set; can't list registered webhooks")
+		return
+	}
+	hooks, err := client.ListWebhooks(ctx)
+	if err != nil {
+		report.add("webhooks", checkFail, "listing webhooks: %v", err)
+		return
+	}
+
+	registered := make(map[string]bool)
+	others := 0
+	for _, h := range hooks {
+		if h.URL == cfg.Server.WebhookURL {
+			registered[h.Event] = true
+		} else {
+			others++
+		}
+	}
+	var missing []string
+	for _, e := range cfg.Server.WebhookEvents {
+		if !registered[e] {
+			missing = append(missing, e)
+		}
+	}
+
+	switch {
+	case len(missing) > 0 && cfg.Server.AutoRegister:
+		report.add("webhooks", checkWarn, "%s not registered for %s; 'pidge serve' will register them", strings.Join(missing, ", "), cfg.Server.WebhookURL)
+	case len(missing) > 0:
+		report.add("webhooks", checkFail, "%s not registered for %s; run 'pidge webhooks sync'", strings.Join(missing, ", "), cfg.Server.WebhookURL)
+	case others > 0:
+		report.add("webhooks", checkWarn, "registered for %s, plus %d webhook(s) for other URLs", cfg.Server.WebhookURL, others)
+	default:
+		report.add("webhooks", checkPass, "registered for %s", cfg.Server.WebhookURL)
+	}
+}
+
+func checkSecret(report *checkReport) {
+	now := time.Now()
+	active := 0
+	for _, s := range cfg.AllWebhookSecrets() {
+		if s.Expires.IsZero() || now.Before(s.Expires) {
+			active++
+		}
+	}
+	if active == 0 {
+		report.add("secret", checkWarn, "no webhook secret; anyone who can reach the server can inject messages")
+		return
+	}
+	report.add("secret", checkPass, "%d active webhook secret(s)", active)
+}
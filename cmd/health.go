@@ -2,32 +2,120 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/android-sms-gateway/client-go/smsgateway"
 	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/healthhistory"
+	"github.com/typhonius/pidge/internal/store"
+	"github.com/typhonius/pidge/pidgeclient"
 )
 
+var (
+	healthCheck   bool
+	healthWarn    []string
+	healthCrit    []string
+	healthHistory string
+)
+
+// Nagios plugin exit codes.
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+var nagiosNames = map[int]string{
+	nagiosOK:       "OK",
+	nagiosWarning:  "WARNING",
+	nagiosCritical: "CRITICAL",
+	nagiosUnknown:  "UNKNOWN",
+}
+
 func init() {
+	healthCmd.Flags().BoolVar(&healthCheck, "check", false, "monitoring mode: print a one-line summary and exit 0 (OK), 1 (WARNING), 2 (CRITICAL) or 3 (UNKNOWN)")
+	healthCmd.Flags().StringArrayVar(&healthWarn, "warn", nil, "warn when a check's observed value crosses a threshold, e.g. 'battery:level<30' (repeatable)")
+	healthCmd.Flags().StringArrayVar(&healthCrit, "crit", nil, "critical when a check's observed value crosses a threshold, e.g. 'battery:level<15' (repeatable)")
+	healthCmd.Flags().StringVar(&healthHistory, "history", "", "report uptime, battery and outages from health recorded by 'pidge serve' since a time or age, e.g. 7d")
+	healthCmd.MarkFlagsMutuallyExclusive("check", "history")
 	rootCmd.AddCommand(healthCmd)
+
+	// A monitoring check reports its own setup errors, such as a bad flag or
+	// a missing config, as UNKNOWN; see Execute.
+	healthCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		// Parsing stops at the bad flag, so --check may not be set yet.
+		if slices.Contains(os.Args[1:], "--check") {
+			healthCheck = true
+		}
+		silenceHealthCheck()
+		return err
+	})
+	cobra.OnInitialize(silenceHealthCheck)
+}
+
+func silenceHealthCheck() {
+	if healthCheck {
+		healthCmd.SilenceErrors = true
+		healthCmd.SilenceUsage = true
+	}
+}
+
+// healthCheckUnknown prints a Nagios UNKNOWN status line and returns its
+// exit code.
+func healthCheckUnknown(format string, args ...any) int {
+	fmt.Printf("PIDGE UNKNOWN - "+format+"\n", args...)
+	return nagiosUnknown
 }
 
 var healthCmd = &cobra.Command{
 	Use:   "health",
 	Short: "Check gateway health",
-	RunE:  runHealth,
+	Long: "Show the gateway's health and the checks it reports, such as battery level and connection.\n\n" +
+		"With --check, print a single Nagios-style status line and exit with its code. The gateway's\n" +
+		"own pass/warn/fail statuses count, plus any --warn and --crit thresholds on observed values:\n\n" +
+		"  pidge health --check --warn 'battery:level<30' --crit 'battery:level<15'\n\n" +
+		"With --server (or [client] server_url), the gateway is checked through that pidge server,\n" +
+		"and the server's own health is included; '--server local' means the one in [server].\n\n" +
+		"'pidge serve' records the gateway's health every health_sample_interval. --history reads\n" +
+		"those samples back as uptime, daily battery levels and outage windows:\n\n" +
+		"  pidge health --history 7d",
+	Args: cobra.NoArgs,
+	RunE: runHealth,
 }
 
 func runHealth(cmd *cobra.Command, args []string) error {
+	if healthCheck {
+		cmd.SilenceUsage = true
+		os.Exit(runHealthCheck())
+	}
+	if healthHistory != "" {
+		return runHealthHistory()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	health, err := client.CheckHealth(ctx)
+	health, server, err := fetchHealth(ctx)
 	if err != nil {
-		return fmt.Errorf("checking health: %w", err)
+		return err
+	}
+	if server != nil && server.Gateway.Status == "unreachable" {
+		return fmt.Errorf("checking health: %s can't reach the gateway: %s", cfg.Client.ServerURL, server.Gateway.Error)
 	}
 
 	if jsonOutput {
+		if server != nil {
+			return printJSON(map[string]any{"gateway": health, "server": server})
+		}
 		return printJSON(health)
 	}
 
@@ -35,9 +123,299 @@ func runHealth(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Version: %s\n", health.Version)
 	if len(health.Checks) > 0 {
 		fmt.Println("\nChecks:")
-		for name, check := range health.Checks {
+		for _, name := range sortedChecks(health.Checks) {
+			check := health.Checks[name]
 			fmt.Printf("  %-20s %s (%d %s)\n", name, check.Status, check.ObservedValue, check.ObservedUnit)
 		}
 	}
+	if server != nil {
+		fmt.Printf("\nServer:  %s (%s)\n", server.Status, cfg.Client.ServerURL)
+		fmt.Printf("  Store:   %d messages, %d unprocessed\n", server.Store.Total, server.Store.Unprocessed)
+		if server.Settings != nil {
+			fmt.Printf("  Settings: %s\n", server.Settings.Status)
+		}
+	}
 	return nil
 }
+
+// fetchHealth returns the gateway's health. In remote mode it's as seen by
+// the pidge server, which is returned too.
+func fetchHealth(ctx context.Context) (smsgateway.HealthResponse, *pidgeclient.Health, error) {
+	if pc := remoteClient(); pc != nil {
+		h, err := pc.Health(ctx)
+		if err != nil {
+			return smsgateway.HealthResponse{}, nil, fmt.Errorf("%s: %w", cfg.Client.ServerURL, err)
+		}
+		return gatewayHealth(h.Gateway), h, nil
+	}
+
+	health, err := client.CheckHealth(ctx)
+	if err != nil {
+		return health, nil, fmt.Errorf("checking health: %w", err)
+	}
+	return health, nil, nil
+}
+
+// runHealthHistory summarises the health samples recorded since --history.
+func runHealthHistory() error {
+	now := time.Now()
+	since, err := parseTimeArg(healthHistory, now)
+	if err != nil {
+		return fmt.Errorf("--history: %w", err)
+	}
+	if !since.Before(now) {
+		return fmt.Errorf("--history must be in the past")
+	}
+
+	samples, err := healthSamples(since, now)
+	if err != nil {
+		return err
+	}
+	summary := healthhistory.Summarize(samples, since, now)
+
+	if jsonOutput {
+		if samples == nil {
+			samples = []store.HealthSample{}
+		}
+		return printJSON(map[string]any{"summary": summary, "samples": samples})
+	}
+
+	if len(samples) == 0 {
+		fmt.Printf("No health samples since %s.\n", since.Format(time.DateTime))
+		fmt.Println("'pidge serve' records one every health_sample_interval.")
+		return nil
+	}
+
+	fmt.Printf("Since:   %s (%d samples)\n", since.Format(time.DateTime), summary.Samples)
+	fmt.Printf("Uptime:  %.2f%%\n", summary.Uptime)
+
+	if b := summary.Battery; b != nil {
+		fmt.Printf("Battery: %d%% -> %d%% (min %d%%, max %d%%)\n", b.First, b.Last, b.Min, b.Max)
+		for _, d := range b.Days {
+			fmt.Printf("  %s  min %3d%%  max %3d%%  avg %3d%%\n", d.Date, d.Min, d.Max, d.Average)
+		}
+	}
+
+	if len(summary.Outages) == 0 {
+		fmt.Println("\nNo outages.")
+		return nil
+	}
+	fmt.Printf("\nOutages (%d):\n", len(summary.Outages))
+	for _, o := range summary.Outages {
+		end := "ongoing"
+		if o.End != nil {
+			end = o.End.Local().Format(time.DateTime)
+		}
+		fmt.Printf("  %s - %-19s  %-10s  %s\n", o.Start.Local().Format(time.DateTime), end, o.Duration(), o.Status)
+	}
+	return nil
+}
+
+// healthSamples reads the health samples recorded between since and until,
+// from the pidge server in remote mode, otherwise from the local database.
+// There are none if 'pidge serve' hasn't created it yet.
+func healthSamples(since, until time.Time) ([]store.HealthSample, error) {
+	if pc := remoteClient(); pc != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		h, err := pc.HealthHistory(ctx, since, until)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.Client.ServerURL, err)
+		}
+		samples := make([]store.HealthSample, len(h.Samples))
+		for i, sample := range h.Samples {
+			samples[i] = healthSample(sample)
+		}
+		return samples, nil
+	}
+
+	st, err := openStoreReadOnly(cfg.ExpandDBPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	return st.ListHealthSamples(since, until)
+}
+
+func sortedChecks(checks smsgateway.HealthChecks) []string {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// threshold is a --warn or --crit condition on a gateway check's observed
+// value.
+type threshold struct {
+	check string
+	op    string
+	value int
+}
+
+var thresholdPattern = regexp.MustCompile(`^([\w:.-]+)\s*(<=|>=|<|>|=)\s*(-?\d+)$`)
+
+func parseThreshold(s string) (threshold, error) {
+	m := thresholdPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return threshold{}, fmt.Errorf("invalid threshold %q: expected check<value, e.g. battery:level<30", s)
+	}
+	v, err := strconv.Atoi(m[3])
+	if err != nil {
+		return threshold{}, fmt.Errorf("invalid threshold %q: %w", s, err)
+	}
+	return threshold{check: m[1], op: m[2], value: v}, nil
+}
+
+func (t threshold) crossed(v int) bool {
+	switch t.op {
+	case "<":
+		return v < t.value
+	case "<=":
+		return v <= t.value
+	case ">":
+		return v > t.value
+	case ">=":
+		return v >= t.value
+	}
+	return v == t.value
+}
+
+func (t threshold) String() string {
+	return fmt.Sprintf("%s%s%d", t.check, t.op, t.value)
+}
+
+// runHealthCheck prints a Nagios-style status line followed by each check
+// and returns the exit code.
+func runHealthCheck() int {
+	var warn, crit []threshold
+	for _, list := range []struct {
+		flags []string
+		into  *[]threshold
+	}{{healthWarn, &warn}, {healthCrit, &crit}} {
+		for _, s := range list.flags {
+			t, err := parseThreshold(s)
+			if err != nil {
+				return healthCheckUnknown("%v", err)
+			}
+			*list.into = append(*list.into, t)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var report checkReport
+	var perfdata []string
+	health, server, err := fetchHealth(ctx)
+	switch {
+	case err != nil && remoteClient() != nil:
+		report.add("server", checkFail, "%v", err)
+	case err != nil:
+		report.add("gateway", checkFail, "unreachable: %v", err)
+	case server != nil && server.Gateway.Status == "unreachable":
+		report.add("gateway", checkFail, "unreachable from the server: %s", server.Gateway.Error)
+	default:
+		report.add("gateway", gatewayCheckStatus(health.Status), "status %s, version %s", health.Status, health.Version)
+		for _, name := range sortedChecks(health.Checks) {
+			c := health.Checks[name]
+			status := gatewayCheckStatus(c.Status)
+			detail := fmt.Sprintf("%s, %d %s", c.Status, c.ObservedValue, c.ObservedUnit)
+			for _, t := range warn {
+				if t.check == name && t.crossed(c.ObservedValue) && status == checkPass {
+					status, detail = checkWarn, fmt.Sprintf("%d %s (warn at %s)", c.ObservedValue, c.ObservedUnit, t)
+				}
+			}
+			for _, t := range crit {
+				if t.check == name && t.crossed(c.ObservedValue) && status != checkFail {
+					status, detail = checkFail, fmt.Sprintf("%d %s (critical at %s)", c.ObservedValue, c.ObservedUnit, t)
+				}
+			}
+			report.add(name, status, "%s", detail)
+			perfdata = append(perfdata, perfValue(name, c))
+		}
+		missing := make(map[string]bool)
+		for _, t := range slices.Concat(warn, crit) {
+			if _, ok := health.Checks[t.check]; !ok && !missing[t.check] {
+				missing[t.check] = true
+				report.add(t.check, checkWarn, "not reported by the gateway (threshold %s)", t)
+			}
+		}
+	}
+
+	if server != nil {
+		checkServerHealth(server, &report)
+	}
+
+	code := nagiosOK
+	var problems []string
+	for _, c := range report.Checks {
+		switch c.Status {
+		case checkFail:
+			code = nagiosCritical
+		case checkWarn:
+			code = max(code, nagiosWarning)
+		default:
+			continue
+		}
+		problems = append(problems, c.Name+": "+c.Detail)
+	}
+
+	if jsonOutput {
+		printJSON(map[string]any{"status": nagiosNames[code], "code": code, "checks": report.Checks})
+		return code
+	}
+
+	summary := fmt.Sprintf("%d checks passed", len(report.Checks))
+	if len(problems) > 0 {
+		summary = strings.Join(problems, "; ")
+	}
+	line := fmt.Sprintf("PIDGE %s - %s", nagiosNames[code], summary)
+	if len(perfdata) > 0 {
+		line += " | " + strings.Join(perfdata, " ")
+	}
+	fmt.Println(line)
+	report.print()
+	return code
+}
+
+// gatewayCheckStatus maps a gateway health status to a check status.
+func gatewayCheckStatus(s smsgateway.HealthStatus) string {
+	switch s {
+	case smsgateway.HealthStatusPass:
+		return checkPass
+	case smsgateway.HealthStatusWarn:
+		return checkWarn
+	}
+	return checkFail
+}
+
+// perfValue formats a check as Nagios performance data.
+func perfValue(name string, c smsgateway.HealthCheck) string {
+	unit := ""
+	if c.ObservedUnit == "percent" {
+		unit = "%"
+	}
+	return fmt.Sprintf("'%s'=%d%s", name, c.ObservedValue, unit)
+}
+
+// checkServerHealth adds the pidge server's own health to report.
+func checkServerHealth(h *pidgeclient.Health, report *checkReport) {
+	switch {
+	case h.Store.Error != "":
+		report.add("server", checkFail, "store: %s", h.Store.Error)
+	case h.Status != "ok":
+		detail := "status " + h.Status
+		if h.Settings != nil && h.Settings.Status != "" {
+			detail += ", device settings " + h.Settings.Status
+		}
+		report.add("server", checkWarn, "%s", detail)
+	default:
+		report.add("server", checkPass, "%s is healthy, %d unprocessed messages", cfg.Client.ServerURL, h.Store.Unprocessed)
+	}
+}
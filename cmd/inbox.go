@@ -1,67 +1,123 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 
-	"github.com/typhonius/pidge/internal/store"
 	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/store"
 )
 
-var unreadOnly bool
+var (
+	unreadOnly     bool
+	inboxProcessed bool
+	inboxPhone     string
+	inboxDevice    string
+	inboxSIM       int
+	inboxSince     string
+	inboxBefore    string
+	inboxLimit     int
+	inboxPage      int
+	inboxOrder     string
+	inboxFull      bool
+)
 
 func init() {
 	inboxCmd.Flags().BoolVar(&unreadOnly, "unread", false, "only show unprocessed messages")
+	inboxCmd.Flags().BoolVar(&inboxProcessed, "processed", false, "only show processed messages")
+	inboxCmd.Flags().StringVar(&inboxPhone, "phone", "", "only show messages from this phone number")
+	inboxCmd.Flags().StringVar(&inboxDevice, "device", "", "only show messages received by this device ID")
+	inboxCmd.Flags().IntVar(&inboxSIM, "sim", 0, "only show messages received on this SIM, 1-3")
+	inboxCmd.Flags().StringVar(&inboxSince, "since", "", "only show messages received since a time or age, e.g. 2h, 7d or 2006-01-02")
+	inboxCmd.Flags().StringVar(&inboxBefore, "before", "", "only show messages received before a time or age")
+	inboxCmd.Flags().IntVar(&inboxLimit, "limit", 50, "messages per page")
+	inboxCmd.Flags().IntVar(&inboxPage, "page", 1, "page of results to show, starting at 1")
+	inboxCmd.Flags().StringVar(&inboxOrder, "order", "desc", "sort by received time: desc (newest first) or asc (oldest first)")
+	inboxCmd.Flags().BoolVar(&inboxFull, "full", false, "show whole message bodies instead of truncating them")
+	inboxCmd.MarkFlagsMutuallyExclusive("unread", "processed")
 	rootCmd.AddCommand(inboxCmd)
 }
 
 var inboxCmd = &cobra.Command{
 	Use:   "inbox",
 	Short: "List received messages",
-	Long:  "List messages received via webhooks. Requires 'pidge serve' to be running to capture incoming SMS.",
-	RunE:  runInbox,
+	Long: "List messages received via webhooks. Requires 'pidge serve' to be running to capture incoming SMS.\n" +
+		"Messages are read through the server if it's answering, otherwise from the database.\n\n" +
+		"The filters match those of GET /api/messages:\n\n" +
+		"  pidge inbox --unread --phone +15551234567 --since 2h --full",
+	Args: cobra.NoArgs,
+	RunE: runInbox,
 }
 
 func runInbox(cmd *cobra.Command, args []string) error {
-	dbPath := cfg.ExpandDBPath()
-	if _, err := os.Stat(dbPath); err != nil {
-		return fmt.Errorf("no message store found at %s — is 'pidge serve' running?", dbPath)
+	f, err := inboxFilter(time.Now())
+	if err != nil {
+		return err
 	}
 
-	st, err := store.Open(dbPath)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ib, err := openInbox(ctx)
 	if err != nil {
-		return fmt.Errorf("opening store: %w", err)
+		return err
 	}
-	defer st.Close()
+	defer ib.Close()
 
-	f := store.ListFilter{Limit: 50}
-	if unreadOnly {
-		unread := false
-		f.Processed = &unread
-	}
-	messages, err := st.ListMessages(f)
+	// Fetch one extra message to tell whether there's another page.
+	f.Limit++
+	messages, err := ib.ListMessages(ctx, f)
 	if err != nil {
-		return fmt.Errorf("listing messages: %w", err)
+		return err
+	}
+	more := len(messages) > inboxLimit
+	if more {
+		messages = messages[:inboxLimit]
 	}
 
 	if jsonOutput {
+		if messages == nil {
+			messages = []store.ReceivedMessage{}
+		}
 		return printJSON(messages)
 	}
 
 	if len(messages) == 0 {
-		fmt.Println("No messages.")
+		if inboxPage > 1 {
+			fmt.Printf("No messages on page %d.\n", inboxPage)
+		} else {
+			fmt.Println("No messages.")
+		}
 		return nil
 	}
 
 	for _, m := range messages {
-		body := m.Message
-		if len(body) > 60 {
-			body = body[:57] + "..."
-		}
 		status := " "
 		if m.Processed {
 			status = "+"
 		}
+		if inboxFull {
+			fmt.Printf("[%s] %3d  %-14s  %s  SIM %d  %s\n",
+				status,
+				m.ID,
+				m.PhoneNumber,
+				m.ReceivedAt.Local().Format("2006-01-02 15:04:05"),
+				m.SimNumber,
+				m.DeviceID,
+			)
+			for _, line := range strings.Split(m.Message, "\n") {
+				fmt.Printf("      %s\n", line)
+			}
+			fmt.Println()
+			continue
+		}
+
+		body := strings.ReplaceAll(m.Message, "\n", " ")
+		if r := []rune(body); len(r) > 60 {
+			body = string(r[:57]) + "..."
+		}
 		fmt.Printf("[%s] %3d  %-14s  %s  %s\n",
 			status,
 			m.ID,
@@ -70,5 +126,62 @@ func runInbox(cmd *cobra.Command, args []string) error {
 			body,
 		)
 	}
+	if more {
+		fmt.Printf("\nShowing page %d; use --page %d for more.\n", inboxPage, inboxPage+1)
+	}
 	return nil
 }
+
+// inboxFilter builds the store filter from the inbox flags.
+func inboxFilter(now time.Time) (store.ListFilter, error) {
+	f := store.ListFilter{
+		Phone:    inboxPhone,
+		DeviceID: inboxDevice,
+	}
+
+	if inboxSIM < 0 || inboxSIM > 3 {
+		return f, fmt.Errorf("--sim must be between 1 and 3")
+	}
+	f.SimNumber = inboxSIM
+
+	if inboxLimit < 1 {
+		return f, fmt.Errorf("--limit must be at least 1")
+	}
+	if inboxPage < 1 {
+		return f, fmt.Errorf("--page must be at least 1")
+	}
+	f.Limit = inboxLimit
+	f.Offset = (inboxPage - 1) * inboxLimit
+
+	switch inboxOrder {
+	case "asc":
+		f.Ascending = true
+	case "desc":
+	default:
+		return f, fmt.Errorf("--order must be asc or desc, not %q", inboxOrder)
+	}
+
+	if unreadOnly || inboxProcessed {
+		processed := inboxProcessed
+		f.Processed = &processed
+	}
+
+	if inboxSince != "" {
+		t, err := parseTimeArg(inboxSince, now)
+		if err != nil {
+			return f, fmt.Errorf("--since: %w", err)
+		}
+		f.Since = &t
+	}
+	if inboxBefore != "" {
+		t, err := parseTimeArg(inboxBefore, now)
+		if err != nil {
+			return f, fmt.Errorf("--before: %w", err)
+		}
+		f.Before = &t
+	}
+	if f.Since != nil && f.Before != nil && !f.Since.Before(*f.Before) {
+		return f, fmt.Errorf("--since must be before --before")
+	}
+	return f, nil
+}
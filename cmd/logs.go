@@ -2,51 +2,273 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/android-sms-gateway/client-go/smsgateway"
 	"github.com/spf13/cobra"
 )
 
+var (
+	logsSince    string
+	logsUntil    string
+	logsModules  []string
+	logsPriority string
+	logsGrep     string
+	logsFollow   bool
+	logsArchived bool
+)
+
+// logFollowInterval is how often --follow polls the gateway.
+const logFollowInterval = 5 * time.Second
+
+// logPriorities are the gateway's log levels, least severe first.
+var logPriorities = []smsgateway.LogEntryPriority{
+	smsgateway.LogEntryPriorityDebug,
+	smsgateway.LogEntryPriorityInfo,
+	smsgateway.LogEntryPriorityWarn,
+	smsgateway.LogEntryPriorityError,
+}
+
 func init() {
+	logsCmd.Flags().StringVar(&logsSince, "since", "24h", "show entries from this time or age, e.g. 2h, 7d or 2006-01-02")
+	logsCmd.Flags().StringVar(&logsUntil, "until", "", "show entries before this time or age (default now)")
+	logsCmd.Flags().StringSliceVar(&logsModules, "module", nil, "only show these modules (repeatable or comma-separated)")
+	logsCmd.Flags().StringVar(&logsPriority, "priority", "", "minimum priority: debug, info, warn or error")
+	logsCmd.Flags().StringVar(&logsGrep, "grep", "", "only show entries whose message, module or context matches this regular expression")
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "keep polling for new entries")
+	logsCmd.Flags().BoolVar(&logsArchived, "archived", false, "read logs archived by 'pidge serve' from the database instead of the device")
+	logsCmd.MarkFlagsMutuallyExclusive("follow", "until")
+	logsCmd.MarkFlagsMutuallyExclusive("follow", "archived")
 	rootCmd.AddCommand(logsCmd)
 }
 
 var logsCmd = &cobra.Command{
 	Use:   "logs",
 	Short: "View device logs",
-	RunE:  runLogs,
+	Long: "Show the gateway device's logs, by default from the last 24 hours.\n\n" +
+		"The phone discards logs after its log lifetime. Set archive_logs = true under [server] to have\n" +
+		"'pidge serve' copy them into the database, and read them back with --archived.",
+	Args: cobra.NoArgs,
+	RunE: runLogs,
 }
 
-func runLogs(cmd *cobra.Command, args []string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// logFilter selects log entries by module, priority and pattern.
+type logFilter struct {
+	modules  []string
+	minLevel int
+	pattern  *regexp.Regexp
+}
 
-	// Fetch logs from the last 24 hours.
-	now := time.Now()
-	from := now.Add(-24 * time.Hour)
+func newLogFilter(modules []string, priority, pattern string) (logFilter, error) {
+	f := logFilter{modules: modules}
+	if priority != "" {
+		f.minLevel = priorityLevel(smsgateway.LogEntryPriority(strings.ToUpper(priority)))
+		if f.minLevel < 0 {
+			return f, fmt.Errorf("--priority: must be debug, info, warn or error")
+		}
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return f, fmt.Errorf("--grep: %w", err)
+		}
+		f.pattern = re
+	}
+	return f, nil
+}
+
+// priorityLevel returns p's position in logPriorities, or -1 if unknown.
+func priorityLevel(p smsgateway.LogEntryPriority) int {
+	return slices.Index(logPriorities, p)
+}
 
-	entries, err := client.GetLogs(ctx, from, now)
+func (f logFilter) match(e smsgateway.LogEntry) bool {
+	if len(f.modules) > 0 && !slices.ContainsFunc(f.modules, func(m string) bool { return strings.EqualFold(m, e.Module) }) {
+		return false
+	}
+	// Unknown priorities are always shown.
+	if level := priorityLevel(e.Priority); level >= 0 && level < f.minLevel {
+		return false
+	}
+	if f.pattern != nil {
+		if f.pattern.MatchString(e.Message) || f.pattern.MatchString(e.Module) {
+			return true
+		}
+		for _, v := range e.Context {
+			if f.pattern.MatchString(v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	filter, err := newLogFilter(logsModules, logsPriority, logsGrep)
 	if err != nil {
-		return fmt.Errorf("fetching logs: %w", err)
+		return err
+	}
+	now := time.Now()
+	from, err := parseTimeArg(logsSince, now)
+	if err != nil {
+		return fmt.Errorf("--since: %w", err)
+	}
+	to := now
+	if logsUntil != "" {
+		if to, err = parseTimeArg(logsUntil, now); err != nil {
+			return fmt.Errorf("--until: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("--since must be before --until")
+	}
+
+	if logsFollow {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return followLogs(ctx, from, filter)
+	}
+
+	var entries []smsgateway.LogEntry
+	if logsArchived {
+		if entries, err = archivedLogs(from, to); err != nil {
+			return err
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if entries, err = client.GetLogs(ctx, from, to); err != nil {
+			return fmt.Errorf("fetching logs: %w", err)
+		}
+		sortLogs(entries)
+	}
+
+	var matched []smsgateway.LogEntry
+	for _, e := range entries {
+		if filter.match(e) {
+			matched = append(matched, e)
+		}
 	}
 
 	if jsonOutput {
-		return printJSON(entries)
+		return printJSON(matched)
 	}
 
-	if len(entries) == 0 {
+	if len(matched) == 0 {
 		fmt.Println("No log entries.")
 		return nil
 	}
 
-	for _, e := range entries {
-		fmt.Printf("[%s] %-5s %-15s %s\n",
-			e.CreatedAt.Local().Format("2006-01-02 15:04:05"),
-			e.Priority,
-			e.Module,
-			e.Message,
-		)
+	for _, e := range matched {
+		printLogEntry(e)
 	}
 	return nil
 }
+
+func printLogEntry(e smsgateway.LogEntry) {
+	fmt.Printf("[%s] %-5s %-15s %s\n",
+		e.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+		e.Priority,
+		e.Module,
+		e.Message,
+	)
+}
+
+func sortLogs(entries []smsgateway.LogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
+
+// followLogs prints matching entries from from onwards, polling for new ones
+// until ctx is cancelled. With --json each entry is a line of JSON.
+func followLogs(ctx context.Context, from time.Time, filter logFilter) error {
+	enc := json.NewEncoder(os.Stdout)
+	seen := make(map[uint64]time.Time)
+	for {
+		reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		entries, err := client.GetLogs(reqCtx, from, time.Now())
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Warning: fetching logs: %v\n", err)
+		}
+
+		sortLogs(entries)
+		for _, e := range entries {
+			if _, ok := seen[e.ID]; ok {
+				continue
+			}
+			seen[e.ID] = e.CreatedAt
+			if e.CreatedAt.After(from) {
+				from = e.CreatedAt
+			}
+			if !filter.match(e) {
+				continue
+			}
+			if jsonOutput {
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			} else {
+				printLogEntry(e)
+			}
+		}
+		// Entries before from won't be returned again.
+		for id, t := range seen {
+			if t.Before(from) {
+				delete(seen, id)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logFollowInterval):
+		}
+	}
+}
+
+// archivedLogs reads entries between from and to from the local database.
+// There are none if 'pidge serve' hasn't created it yet.
+func archivedLogs(from, to time.Time) ([]smsgateway.LogEntry, error) {
+	st, err := openStoreReadOnly(cfg.ExpandDBPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+
+	logs, err := st.ListDeviceLogs(from, to)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]smsgateway.LogEntry, len(logs))
+	for i, l := range logs {
+		entries[i] = smsgateway.LogEntry{
+			ID:        l.LogID,
+			Priority:  smsgateway.LogEntryPriority(l.Priority),
+			Module:    l.Module,
+			Message:   l.Message,
+			Context:   l.Context,
+			CreatedAt: l.CreatedAt,
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/control"
+)
+
+var reloadDB string
+
+func init() {
+	reloadCmd.Flags().StringVar(&reloadDB, "db", "", "database path of the instance to reload (default from config)")
+	rootCmd.AddCommand(reloadCmd)
+}
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload a running server's configuration",
+	Long:  "Ask the pidge serve instance using the configured database (or --db) to re-read its config file, like SIGHUP.",
+	Args:  cobra.NoArgs,
+	RunE:  runReload,
+}
+
+func runReload(cmd *cobra.Command, args []string) error {
+	dbPath := instanceDBPath(reloadDB)
+	if _, err := control.Call(dbPath, control.Request{Command: control.CmdReload}); err != nil {
+		return fmt.Errorf("reloading %s: %w", dbPath, err)
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]string{"status": "reloaded", "db": dbPath})
+	}
+
+	fmt.Println("Configuration reloaded.")
+	return nil
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/android-sms-gateway/client-go/smsgateway"
+	"github.com/typhonius/pidge/internal/config"
+	"github.com/typhonius/pidge/internal/store"
+	"github.com/typhonius/pidge/pidgeclient"
+)
+
+// remoteClient returns a client for the pidge server named by --server or
+// [client] server_url, or nil if commands should use the local database and
+// the gateway.
+func remoteClient() *pidgeclient.Client {
+	if cfg.Client.ServerURL == "" {
+		return nil
+	}
+	return pidgeclient.New(cfg.Client.ServerURL)
+}
+
+// localServerURL guesses the URL of the pidge server configured in c. A TLS
+// server is reached through webhook_url's host so its certificate matches.
+func localServerURL(c *config.Config) string {
+	host, port, err := net.SplitHostPort(c.Server.Listen)
+	if err != nil {
+		return "http://" + c.Server.Listen
+	}
+	if c.Server.TLSCert != "" {
+		if u, err := url.Parse(c.Server.WebhookURL); err == nil && u.Hostname() != "" {
+			return "https://" + net.JoinHostPort(u.Hostname(), port)
+		}
+		return "https://" + net.JoinHostPort("localhost", port)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// gatewayState converts a message state from the pidge server to the
+// gateway's type, so remote and local output match.
+func gatewayState(m pidgeclient.MessageState) smsgateway.MessageState {
+	state := smsgateway.MessageState{
+		ID:          m.ID,
+		DeviceID:    m.DeviceID,
+		State:       smsgateway.ProcessingState(m.State),
+		IsHashed:    m.IsHashed,
+		IsEncrypted: m.IsEncrypted,
+		Recipients:  make([]smsgateway.RecipientState, len(m.Recipients)),
+		States:      m.States,
+	}
+	for i, r := range m.Recipients {
+		state.Recipients[i] = smsgateway.RecipientState{
+			PhoneNumber: r.PhoneNumber,
+			State:       smsgateway.ProcessingState(r.State),
+			Error:       r.Error,
+		}
+	}
+	return state
+}
+
+// receivedMessage converts a message from the pidge server to the store's
+// type, so remote and local output match.
+func receivedMessage(m pidgeclient.Message) store.ReceivedMessage {
+	return store.ReceivedMessage{
+		ID:          m.ID,
+		EventID:     m.EventID,
+		MessageID:   m.MessageID,
+		DeviceID:    m.DeviceID,
+		PhoneNumber: m.PhoneNumber,
+		Message:     m.Message,
+		SimNumber:   m.SimNumber,
+		ReceivedAt:  m.ReceivedAt,
+		CreatedAt:   m.CreatedAt,
+		Processed:   m.Processed,
+	}
+}
+
+// healthSample converts a recorded health sample from the pidge server to
+// the store's type.
+func healthSample(h pidgeclient.HealthSample) store.HealthSample {
+	sample := store.HealthSample{
+		SampledAt: h.SampledAt,
+		Status:    h.Status,
+		Version:   h.Version,
+		Error:     h.Error,
+	}
+	if len(h.Checks) > 0 {
+		sample.Checks = make(map[string]store.HealthCheck, len(h.Checks))
+		for name, c := range h.Checks {
+			sample.Checks[name] = store.HealthCheck{Status: c.Status, Value: c.Value, Unit: c.Unit}
+		}
+	}
+	return sample
+}
+
+// gatewayHealth converts the gateway's health as reported by the pidge
+// server to the gateway's own type.
+func gatewayHealth(g pidgeclient.GatewayHealth) smsgateway.HealthResponse {
+	health := smsgateway.HealthResponse{
+		Status:  smsgateway.HealthStatus(g.Status),
+		Version: g.Version,
+		Checks:  make(smsgateway.HealthChecks, len(g.Checks)),
+	}
+	for name, c := range g.Checks {
+		health.Checks[name] = smsgateway.HealthCheck{
+			Description:   c.Description,
+			ObservedUnit:  c.ObservedUnit,
+			ObservedValue: c.ObservedValue,
+			Status:        smsgateway.HealthStatus(c.Status),
+		}
+	}
+	return health
+}
@@ -12,54 +12,98 @@ import (
 )
 
 var (
-	jsonOutput bool
-	configPath string
-	cfg        *config.Config
-	client     *smsgateway.Client
+	jsonOutput   bool
+	configPath   string
+	remoteServer string
+	cfg          *config.Config
+	client       *smsgateway.Client
 )
 
+// needsGateway is the annotation on commands that talk to the gateway
+// directly, rather than optionally through a pidge server.
+const needsGateway = "needsGateway"
+
 var rootCmd = &cobra.Command{
 	Use:   "pidge",
 	Short: "CLI for Android SMS Gateway",
 	Long:  "A command-line tool for interacting with Android SMS Gateway's local API.",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRemoteServer(cmd); err != nil {
+			return err
+		}
 		// Skip config loading for setup command.
 		if cmd.Name() == "setup" {
 			return nil
 		}
-		return loadConfig()
+		if err := loadConfig(); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		if client == nil && requiresGateway(cmd) {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("'%s' talks to the gateway directly, so needs [gateway] in the config", cmd.CommandPath())
+		}
+		return nil
 	},
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return
 	}
+	if cmd == healthCmd && healthCheck {
+		os.Exit(healthCheckUnknown("%v", err))
+	}
+	os.Exit(1)
 }
 
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "output in JSON format")
 	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "config file path (default ~/.config/pidge/config.toml)")
+	rootCmd.PersistentFlags().StringVar(&remoteServer, "server", "", "use this pidge server's API instead of the local database and gateway, or 'local' for the one in [server] (default [client] server_url)")
+
+	// Not all of 'webhooks': rotate-secret and test only use the config.
+	for _, c := range []*cobra.Command{
+		serveCmd, doctorCmd, logsCmd, settingsCmd,
+		webhooksListCmd, webhooksAddCmd, webhooksDeleteCmd, webhooksSyncCmd,
+	} {
+		c.Annotations = map[string]string{needsGateway: "true"}
+	}
+}
+
+// resolveConfigPath returns --config or the default config path.
+func resolveConfigPath() (string, error) {
+	if configPath != "" {
+		return configPath, nil
+	}
+	return config.DefaultPath()
 }
 
 func loadConfig() error {
-	path := configPath
-	if path == "" {
-		p, err := config.DefaultPath()
-		if err != nil {
-			return err
-		}
-		path = p
+	path, err := resolveConfigPath()
+	if err != nil {
+		return err
 	}
 
 	c, err := config.Load(path)
 	if err != nil {
 		var pathErr *os.PathError
-		if errors.As(err, &pathErr) && errors.Is(pathErr.Err, os.ErrNotExist) {
-			fmt.Fprintln(os.Stderr, "No config file found. Run 'pidge setup' to create one.")
-			os.Exit(1)
+		if !errors.As(err, &pathErr) || pathErr.Path != path || !errors.Is(pathErr.Err, os.ErrNotExist) {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		// A config file is optional when going through a pidge server.
+		c = config.Empty()
+		if remoteServer == "" && c.Client.ServerURL == "" {
+			return fmt.Errorf("no config file found at %s; run 'pidge setup' to create one", path)
 		}
-		return fmt.Errorf("loading config: %w", err)
+	}
+
+	if remoteServer != "" {
+		c.Client.ServerURL = remoteServer
+	}
+	if c.Client.ServerURL == "local" {
+		c.Client.ServerURL = localServerURL(c)
 	}
 
 	if err := c.Validate(); err != nil {
@@ -67,13 +111,40 @@ func loadConfig() error {
 	}
 
 	cfg = c
-	sdkConfig := smsgateway.Config{}.
-		WithBaseURL(cfg.Gateway.URL).
-		WithBasicAuth(cfg.Gateway.Username, cfg.Gateway.Password)
-	client = smsgateway.NewClient(sdkConfig)
+	if c.Gateway.URL != "" {
+		client = newGatewayClient(c)
+	}
+	return nil
+}
+
+// checkRemoteServer rejects --server for commands that talk to the gateway
+// directly.
+func checkRemoteServer(cmd *cobra.Command) error {
+	if remoteServer != "" && requiresGateway(cmd) {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("'%s' talks to the gateway directly and does not support --server", cmd.CommandPath())
+	}
 	return nil
 }
 
+// requiresGateway reports whether cmd or a parent is annotated needsGateway.
+func requiresGateway(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[needsGateway] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newGatewayClient returns an SMS gateway client for c's [gateway] section.
+func newGatewayClient(c *config.Config) *smsgateway.Client {
+	sdkConfig := smsgateway.Config{}.
+		WithBaseURL(c.Gateway.URL).
+		WithBasicAuth(c.Gateway.Username, c.Gateway.Password)
+	return smsgateway.NewClient(sdkConfig)
+}
+
 // printJSON marshals v to JSON and writes to stdout.
 func printJSON(v any) error {
 	enc := json.NewEncoder(os.Stdout)
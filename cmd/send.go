@@ -8,43 +8,181 @@ import (
 
 	"github.com/android-sms-gateway/client-go/smsgateway"
 	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/e2e"
+	"github.com/typhonius/pidge/internal/sms"
+	"github.com/typhonius/pidge/pidgeclient"
+)
+
+var (
+	sendSIM              int
+	sendTTL              time.Duration
+	sendValidUntil       string
+	sendPriority         int
+	sendNoDeliveryReport bool
+	sendDevice           string
+	sendDryRun           bool
+	sendTransliterate    bool
+	sendWait             bool
+	sendWaitTimeout      time.Duration
 )
 
 func init() {
+	sendCmd.Flags().IntVar(&sendSIM, "sim", 0, "SIM card to send from, 1-3 (default: the device's default SIM)")
+	sendCmd.Flags().DurationVar(&sendTTL, "ttl", 0, "give up if not sent within this long, e.g. 1h")
+	sendCmd.Flags().StringVar(&sendValidUntil, "valid-until", "", "give up if not sent by this RFC 3339 time")
+	sendCmd.Flags().IntVar(&sendPriority, "priority", 0, "priority from -128 to 127; 100 or more bypasses send limits")
+	sendCmd.Flags().BoolVar(&sendNoDeliveryReport, "no-delivery-report", false, "don't request a delivery report")
+	sendCmd.Flags().StringVar(&sendDevice, "device", "", "ID of the device to send from (see the gateway's device list)")
+	sendCmd.Flags().BoolVar(&sendDryRun, "dry-run", false, "show the encoding and segments without sending")
+	sendCmd.Flags().BoolVar(&sendTransliterate, "transliterate", false, "replace smart quotes and accents outside GSM-7 with plain equivalents")
+	sendCmd.Flags().BoolVar(&sendWait, "wait", false, "wait until every recipient is Delivered or Failed (Sent with --no-delivery-report)")
+	sendCmd.Flags().DurationVar(&sendWaitTimeout, "timeout", 5*time.Minute, "how long --wait waits")
+	sendCmd.MarkFlagsMutuallyExclusive("ttl", "valid-until")
+	sendCmd.MarkFlagsMutuallyExclusive("dry-run", "wait")
 	rootCmd.AddCommand(sendCmd)
 }
 
 var sendCmd = &cobra.Command{
-	Use:   "send <number> <message...>",
+	Use:   "send <number>[,<number>...] <message...>",
 	Short: "Send an SMS",
-	Long:  "Send a text message to the specified phone number.",
-	Args:  cobra.MinimumNArgs(2),
-	RunE:  runSend,
+	Long: "Send a text message to one or more comma-separated phone numbers.\n\n" +
+		"A message with any character outside the GSM-7 alphabet, such as an emoji, is sent as UCS-2\n" +
+		"and splits after 70 characters instead of 160. Use --dry-run to check, and --transliterate\n" +
+		"to replace smart quotes and accented letters with GSM-7 equivalents.\n\n" +
+		"With --wait, keep polling after sending as 'pidge status --wait' does.",
+	Args: cobra.MinimumNArgs(2),
+	RunE: runSend,
 }
 
 func runSend(cmd *cobra.Command, args []string) error {
-	number := args[0]
-	message := strings.Join(args[1:], " ")
+	opts := sms.Options{
+		PhoneNumbers:     sms.SplitRecipients(args[0]),
+		Text:             strings.Join(args[1:], " "),
+		SimNumber:        sendSIM,
+		TTL:              sendTTL,
+		Priority:         sendPriority,
+		NoDeliveryReport: sendNoDeliveryReport,
+		DeviceID:         sendDevice,
+		Transliterate:    sendTransliterate,
+		MaxSegments:      cfg.Gateway.MaxSegments,
+	}
+	if sendValidUntil != "" {
+		t, err := time.Parse(time.RFC3339, sendValidUntil)
+		if err != nil {
+			return fmt.Errorf("--valid-until: expected RFC 3339 time such as 2026-01-02T15:04:05Z: %w", err)
+		}
+		opts.ValidUntil = t
+	}
+	if sendDryRun {
+		if err := printAnalysis(opts); err != nil {
+			return err
+		}
+		_, err := opts.Message()
+		return err
+	}
+	msg, err := opts.Message()
+	if err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	state, err := client.Send(ctx, smsgateway.Message{
-		TextMessage:  &smsgateway.TextMessage{Text: message},
-		PhoneNumbers: []string{number},
-	})
+	state, err := sendMessage(ctx, opts, msg)
 	if err != nil {
 		return fmt.Errorf("sending message: %w", err)
 	}
 
 	if jsonOutput {
+		if sendWait {
+			cmd.SilenceUsage = true
+			return waitForDelivery(state.ID, sendWaitTimeout, sendDone())
+		}
 		return printJSON(state)
 	}
 
+	a := opts.Analyze()
 	fmt.Printf("Message sent (ID: %s)\n", state.ID)
 	fmt.Printf("State: %s\n", state.State)
+	fmt.Printf("Segments: %d (%s)\n", len(a.Segments), a.Encoding)
 	for _, r := range state.Recipients {
 		fmt.Printf("  %s: %s\n", r.PhoneNumber, r.State)
 	}
+	if sendWait {
+		cmd.SilenceUsage = true
+		fmt.Println()
+		return waitForDelivery(state.ID, sendWaitTimeout, sendDone())
+	}
+	return nil
+}
+
+// sendMessage sends msg through the pidge server in remote mode, where the
+// server encrypts it, otherwise straight to the gateway.
+func sendMessage(ctx context.Context, opts sms.Options, msg smsgateway.Message) (smsgateway.MessageState, error) {
+	if pc := remoteClient(); pc != nil {
+		req := pidgeclient.SendRequest{
+			PhoneNumbers:  opts.PhoneNumbers,
+			Message:       opts.Text,
+			SimNumber:     opts.SimNumber,
+			TTL:           int64(opts.TTL.Seconds()),
+			Priority:      opts.Priority,
+			DeviceID:      opts.DeviceID,
+			Transliterate: opts.Transliterate,
+		}
+		if !opts.ValidUntil.IsZero() {
+			req.ValidUntil = &opts.ValidUntil
+		}
+		if opts.NoDeliveryReport {
+			report := false
+			req.WithDeliveryReport = &report
+		}
+		res, err := pc.Send(ctx, req)
+		if err != nil {
+			return smsgateway.MessageState{}, err
+		}
+		return gatewayState(res.MessageState), nil
+	}
+
+	passphrase := cfg.Gateway.EncryptionPassphrase
+	if passphrase != "" {
+		if err := e2e.EncryptMessage(passphrase, &msg); err != nil {
+			return smsgateway.MessageState{}, fmt.Errorf("encrypting message: %w", err)
+		}
+	}
+	state, err := client.Send(ctx, msg)
+	if err != nil {
+		return state, err
+	}
+	e2e.DecryptState(passphrase, &state)
+	return state, nil
+}
+
+// sendDone is the final recipient state for --wait. Without a delivery
+// report, a message never gets past Sent.
+func sendDone() func(smsgateway.ProcessingState) bool {
+	if sendNoDeliveryReport {
+		return isSent
+	}
+	return isDelivered
+}
+
+// printAnalysis shows how the message in opts will be encoded and split.
+func printAnalysis(opts sms.Options) error {
+	a := opts.Analyze()
+	if jsonOutput {
+		return printJSON(map[string]any{"recipients": opts.PhoneNumbers, "analysis": a})
+	}
+
+	fmt.Printf("Recipients: %s\n", strings.Join(opts.PhoneNumbers, ", "))
+	fmt.Printf("Encoding:   %s", a.Encoding)
+	if len(a.NonGSM) > 0 {
+		fmt.Printf(" (because of %s)", strings.Join(a.NonGSM, " "))
+	}
+	fmt.Println()
+	fmt.Printf("Length:     %d characters, %d units\n", a.Characters, a.Units)
+	fmt.Printf("Segments:   %d of up to %d units\n", len(a.Segments), a.PerSegment)
+	for i, seg := range a.Segments {
+		fmt.Printf("  %d. [%3d] %s\n", i+1, seg.Units, seg.Text)
+	}
 	return nil
 }
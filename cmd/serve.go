@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,20 +11,26 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/android-sms-gateway/client-go/smsgateway"
+	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/config"
+	"github.com/typhonius/pidge/internal/control"
 	"github.com/typhonius/pidge/internal/server"
 	"github.com/typhonius/pidge/internal/store"
-	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/systemd"
+	"github.com/typhonius/pidge/internal/webhooks"
 )
 
 var (
-	serveListen string
-	serveDB     string
+	serveListen   string
+	serveDB       string
+	serveStatusDB string
 )
 
 func init() {
 	serveCmd.Flags().StringVar(&serveListen, "listen", "", "listen address (default from config or :3851)")
 	serveCmd.Flags().StringVar(&serveDB, "db", "", "database path (default from config)")
+	serveStatusCmd.Flags().StringVar(&serveStatusDB, "db", "", "database path of the instance to query (default from config)")
+	serveCmd.AddCommand(serveStatusCmd)
 	rootCmd.AddCommand(serveCmd)
 }
 
@@ -33,6 +41,53 @@ var serveCmd = &cobra.Command{
 	RunE:  runServe,
 }
 
+var serveStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether a pidge server is running",
+	Long:  "Query the pidge serve instance using the configured database (or --db) over its control socket.",
+	Args:  cobra.NoArgs,
+	RunE:  runServeStatus,
+}
+
+func runServeStatus(cmd *cobra.Command, args []string) error {
+	dbPath := instanceDBPath(serveStatusDB)
+	resp, err := control.Call(dbPath, control.Request{Command: control.CmdStatus})
+	if err != nil {
+		if errors.Is(err, control.ErrNotRunning) {
+			cmd.SilenceUsage = true
+			if jsonOutput {
+				printJSON(map[string]any{"running": false, "dbPath": dbPath})
+			}
+			return fmt.Errorf("not running (db %s)", dbPath)
+		}
+		return err
+	}
+
+	var status serveStatus
+	if err := json.Unmarshal(resp.Status, &status); err != nil {
+		return fmt.Errorf("decoding status: %w", err)
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]any{"running": true, "server": status})
+	}
+
+	fmt.Printf("Running:  pid %d, up %s\n", status.PID, status.Uptime)
+	fmt.Printf("Listen:   %s", status.Listen)
+	if status.TLS {
+		fmt.Print(" (TLS)")
+	}
+	fmt.Println()
+	fmt.Printf("Database: %s\n", status.DBPath)
+	if status.ConfigPath != "" {
+		fmt.Printf("Config:   %s\n", status.ConfigPath)
+	}
+	if status.Store != nil {
+		fmt.Printf("Messages: %d total, %d unprocessed\n", status.Store.Total, status.Store.Unprocessed)
+	}
+	return nil
+}
+
 func runServe(cmd *cobra.Command, args []string) error {
 	// Apply flag overrides
 	listen := cfg.Server.Listen
@@ -44,19 +99,43 @@ func runServe(cmd *cobra.Command, args []string) error {
 		dbPath = serveDB
 	}
 
+	// Claim the control socket first so a second server for the same
+	// database fails before touching it.
+	ctlCh := make(chan controlRequest)
+	started := time.Now()
+	ctl, err := control.Listen(dbPath, func(req control.Request) control.Response {
+		reply := make(chan control.Response, 1)
+		select {
+		case ctlCh <- controlRequest{command: req.Command, reply: reply}:
+			return <-reply
+		case <-time.After(10 * time.Second):
+			return control.Response{Error: "server busy"}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer ctl.Close()
+
 	slog.Info("opening database", "path", dbPath)
-	st, err := store.Open(dbPath)
+	st, err := openStore(dbPath)
 	if err != nil {
-		return fmt.Errorf("opening store: %w", err)
+		return err
 	}
 	defer st.Close()
 
-	srv := server.New(st, client, cfg.Server.WebhookSecret)
+	level, err := cfg.SlogLevel()
+	if err != nil {
+		return err
+	}
+	slog.SetLogLoggerLevel(level)
+
+	srv := server.New(st, client, serverOptions(cfg))
 
-	// Auto-register webhook
+	// Reconcile the gateway's webhooks with the configured events
 	if cfg.Server.AutoRegister && cfg.Server.WebhookURL != "" {
-		if err := autoRegisterWebhook(cfg.Server.WebhookURL); err != nil {
-			slog.Warn("auto-register webhook failed", "error", err)
+		if err := syncWebhooks(cfg, st); err != nil {
+			slog.Warn("webhook sync failed", "error", err)
 		}
 	}
 
@@ -64,59 +143,301 @@ func runServe(cmd *cobra.Command, args []string) error {
 	certFile := expandHome(cfg.Server.TLSCert)
 	keyFile := expandHome(cfg.Server.TLSKey)
 
-	// Graceful shutdown
+	ln, err := srv.Listen(listen, certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	listen = ln.Addr().String()
 	errCh := make(chan error, 1)
 	go func() {
-		errCh <- srv.Start(listen, certFile, keyFile)
+		errCh <- srv.Serve(ln)
 	}()
 
+	// The store is open and the listener bound: tell systemd we're up.
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		slog.Warn("sd_notify failed", "error", err)
+	}
+	// The watchdog is fed from the serve loop below, and only while the
+	// store answers, so a wedged loop or database gets us restarted.
+	var watchdog <-chan time.Time
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		t := time.NewTicker(interval / 2)
+		defer t.Stop()
+		watchdog = t.C
+	}
+
+	// Always watched, since a reload can add [gateway.settings].
+	if len(cfg.Gateway.Settings) > 0 {
+		slog.Info("checking device settings", "interval", cfg.Server.SettingsCheckInterval.Duration, "enforce", cfg.Server.EnforceSettings)
+	}
+	stopSettings := make(chan struct{})
+	defer close(stopSettings)
+	go srv.WatchSettings(stopSettings, cfg.Server.SettingsCheckInterval.Duration)
+
+	stopSampler := make(chan struct{})
+	defer close(stopSampler)
+	go srv.SampleHealth(stopSampler, cfg.Server.HealthSampleInterval.Duration,
+		time.Duration(cfg.Server.HealthRetentionDays)*24*time.Hour)
+
+	if cfg.Server.ArchiveLogs {
+		slog.Info("archiving device logs", "interval", cfg.Server.LogArchiveInterval.Duration)
+		stopArchiver := make(chan struct{})
+		defer close(stopArchiver)
+		go srv.ArchiveLogs(stopArchiver, cfg.Server.LogArchiveInterval.Duration,
+			time.Duration(cfg.Server.LogRetentionDays)*24*time.Hour)
+	}
+
+	// Graceful shutdown
+
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	select {
-	case err := <-errCh:
-		return err
-	case sig := <-sigCh:
-		slog.Info("received signal", "signal", sig)
+	current := cfg
+	reload := func() error {
+		systemd.Notify(systemd.Reloading)
+		defer systemd.Notify(systemd.Ready)
+		next, err := reloadServeConfig(srv, current, certFile != "")
+		if err != nil {
+			slog.Error("config reload failed; keeping current config", "error", err)
+			return err
+		}
+		current = next
+		return nil
+	}
+	shutdown := func() error {
+		systemd.Notify(systemd.Stopping)
+		if current.Server.UnregisterOnShutdown && current.Server.WebhookURL != "" {
+			unregisterWebhooks(current)
+		}
 		if err := srv.Shutdown(10 * time.Second); err != nil {
 			slog.Error("shutdown error", "error", err)
 		}
 		slog.Info("server stopped")
 		return nil
 	}
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-watchdog:
+			if err := pingStore(st); err != nil {
+				slog.Error("store not answering; withholding watchdog ping", "error", err)
+				continue
+			}
+			systemd.Notify(systemd.Watchdog)
+		case sig := <-sigCh:
+			slog.Info("received signal", "signal", sig)
+			if sig == syscall.SIGHUP {
+				reload()
+				continue
+			}
+			return shutdown()
+		case req := <-ctlCh:
+			switch req.command {
+			case control.CmdStatus:
+				status := serveStatus{
+					PID:        os.Getpid(),
+					Listen:     listen,
+					DBPath:     dbPath,
+					ConfigPath: configPath,
+					TLS:        certFile != "",
+					StartedAt:  started,
+					Uptime:     time.Since(started).Round(time.Second).String(),
+				}
+				status.Store, _ = st.Stats()
+				b, _ := json.Marshal(status)
+				req.reply <- control.Response{OK: true, Status: b}
+			case control.CmdReload:
+				slog.Info("reload requested via control socket")
+				if err := reload(); err != nil {
+					req.reply <- control.Response{Error: err.Error()}
+				} else {
+					req.reply <- control.Response{OK: true}
+				}
+			case control.CmdStop:
+				slog.Info("stop requested via control socket")
+				req.reply <- control.Response{OK: true}
+				return shutdown()
+			default:
+				req.reply <- control.Response{Error: fmt.Sprintf("unknown command %q", req.command)}
+			}
+		}
+	}
 }
 
-// autoRegisterWebhook checks existing webhooks and registers one for sms:received
-// if none exists for our URL.
-func autoRegisterWebhook(webhookURL string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// pingStore checks that the store still answers queries.
+func pingStore(st *store.Store) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	return st.Ping(ctx)
+}
+
+// controlRequest hands a request from the control socket to the serve loop.
+type controlRequest struct {
+	command string
+	reply   chan control.Response
+}
+
+// serveStatus is reported by 'pidge serve status'.
+type serveStatus struct {
+	PID        int          `json:"pid"`
+	Listen     string       `json:"listen"`
+	DBPath     string       `json:"dbPath"`
+	ConfigPath string       `json:"configPath,omitempty"`
+	TLS        bool         `json:"tls"`
+	StartedAt  time.Time    `json:"startedAt"`
+	Uptime     string       `json:"uptime"`
+	Store      *store.Stats `json:"store,omitempty"`
+}
+
+// reloadableKeys are config keys applied by SIGHUP without a restart.
+var reloadableKeys = map[string]bool{
+	"gateway.encryption_passphrase":    true,
+	"gateway.max_segments":             true,
+	"gateway.settings":                 true,
+	"server.webhook_secret":            true,
+	"server.webhook_secrets":           true,
+	"server.webhook_secret_file":       true,
+	"server.webhook_secret_command":    true,
+	"server.webhook_secret_credential": true,
+	"server.webhook_tolerance":         true,
+	"server.log_level":                 true,
+	"server.enforce_settings":          true,
+	"server.tls_cert":                  true,
+	"server.tls_key":                   true,
+}
 
-	hooks, err := client.ListWebhooks(ctx)
+// reloadServeConfig re-reads the config file and applies the sections that
+// can change while serving, logging every changed key. Keys that need a
+// restart keep their old values in the returned config.
+func reloadServeConfig(srv *server.Server, old *config.Config, tlsEnabled bool) (*config.Config, error) {
+	path, err := resolveConfigPath()
 	if err != nil {
-		return fmt.Errorf("listing webhooks: %w", err)
+		return nil, err
 	}
+	next, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	level, err := next.SlogLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	certFile := expandHome(next.Server.TLSCert)
+	keyFile := expandHome(next.Server.TLSKey)
+	tlsReloadable := tlsEnabled && certFile != "" && keyFile != ""
 
-	// Check if our URL is already registered for sms:received
-	for _, h := range hooks {
-		if h.URL == webhookURL && h.Event == "sms:received" {
-			slog.Info("webhook already registered", "id", h.ID, "url", h.URL)
-			return nil
+	oldFields := old.Fields()
+	for i, f := range next.Fields() {
+		if f.Equal(oldFields[i]) {
+			continue
+		}
+		reloadable := reloadableKeys[f.Key]
+		if f.Key == "server.tls_cert" || f.Key == "server.tls_key" {
+			reloadable = tlsReloadable
+		}
+		switch {
+		case reloadable && f.Secret:
+			slog.Info("config changed", "key", f.Key)
+		case reloadable:
+			slog.Info("config changed", "key", f.Key, "value", f.String())
+		default:
+			// Keep what's actually running, so the change is reported
+			// again on the next reload and never read as applied.
+			slog.Warn("config changed but requires a restart", "key", f.Key)
+			f.CopyFrom(oldFields[i])
 		}
 	}
 
-	hook, err := client.RegisterWebhook(ctx, smsgateway.Webhook{
-		URL:   webhookURL,
-		Event: "sms:received",
-	})
-	if err != nil {
-		return fmt.Errorf("registering webhook: %w", err)
+	if tlsReloadable {
+		if err := srv.ReloadTLS(certFile, keyFile); err != nil {
+			return nil, err
+		}
+	}
+	srv.Reload(serverOptions(next))
+	slog.SetLogLoggerLevel(level)
+	slog.Info("config reloaded", "path", path)
+	return next, nil
+}
+
+// serverOptions builds the server's reloadable options from c.
+func serverOptions(c *config.Config) server.Options {
+	// Validate has already rejected bad settings.
+	desired, _ := c.DesiredSettings()
+	return server.Options{
+		WebhookSecrets:       webhookSecrets(c),
+		WebhookTolerance:     c.Server.WebhookTolerance.Duration,
+		EncryptionPassphrase: c.Gateway.EncryptionPassphrase,
+		MaxSegments:          c.Gateway.MaxSegments,
+		DesiredSettings:      desired,
+		EnforceSettings:      c.Server.EnforceSettings,
+	}
+}
+
+// syncWebhooks reconciles the gateway's webhooks with webhook_url and
+// webhook_events, logging each change. The URL is recorded in st so hooks
+// left at it can be adopted after webhook_url changes.
+func syncWebhooks(c *config.Config, st *store.Store) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var previous []string
+	if url, err := st.WebhookURL(); err != nil {
+		slog.Warn("reading previous webhook url", "error", err)
+	} else if url != "" {
+		previous = append(previous, url)
 	}
 
-	slog.Info("webhook registered", "id", hook.ID, "url", hook.URL, "event", hook.Event)
+	actions, err := webhooks.Sync(ctx, client, c.Server.WebhookURL, c.Server.WebhookEvents, previous, false)
+	if err != nil {
+		return err
+	}
+	if err := st.SetWebhookURL(c.Server.WebhookURL); err != nil {
+		slog.Warn("recording webhook url", "error", err)
+	}
+	for _, a := range actions {
+		switch a.Op {
+		case "add":
+			slog.Info("webhook registered", "id", a.ID, "url", a.URL, "event", a.Event)
+		case "adopt":
+			slog.Info("webhook adopted", "id", a.ID, "replaces", a.Replaces, "url", a.URL, "event", a.Event)
+		case "delete":
+			slog.Info("stale webhook removed", "id", a.ID, "url", a.URL, "event", a.Event)
+		default:
+			slog.Debug("webhook already registered", "id", a.ID, "url", a.URL, "event", a.Event)
+		}
+	}
 	return nil
 }
 
+// unregisterWebhooks removes pidge's webhooks for webhook_url.
+func unregisterWebhooks(c *config.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	deleted, err := webhooks.Unregister(ctx, client, c.Server.WebhookURL)
+	if err != nil {
+		slog.Warn("unregistering webhooks failed", "error", err)
+	}
+	for _, id := range deleted {
+		slog.Info("webhook unregistered", "id", id)
+	}
+}
+
+// webhookSecrets converts the configured secrets for the server.
+func webhookSecrets(c *config.Config) []server.WebhookSecret {
+	var secrets []server.WebhookSecret
+	for _, s := range c.AllWebhookSecrets() {
+		secrets = append(secrets, server.WebhookSecret{Secret: s.Secret, Expires: s.Expires})
+	}
+	return secrets
+}
+
 func expandHome(path string) string {
 	if len(path) >= 2 && path[:2] == "~/" {
 		if home, err := os.UserHomeDir(); err == nil {
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceUser   bool
+	serviceSocket bool
+	servicePrint  bool
+	serviceForce  bool
+)
+
+func init() {
+	serviceInstallCmd.Flags().BoolVar(&serviceUser, "user", false, "install a systemd user unit (required)")
+	serviceInstallCmd.Flags().BoolVar(&serviceSocket, "socket", false, "also install a pidge.socket unit for socket activation")
+	serviceInstallCmd.Flags().BoolVar(&servicePrint, "print", false, "print the units instead of writing them")
+	serviceInstallCmd.Flags().BoolVar(&serviceForce, "force", false, "overwrite existing unit files")
+	serviceCmd.AddCommand(serviceInstallCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run pidge serve under systemd",
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Generate a systemd unit for pidge serve",
+	Long: "Write a hardened systemd user unit that runs 'pidge serve' with the current binary and config.\n" +
+		"The database directory is the only writable path. With --socket, a pidge.socket unit binds\n" +
+		"the listen address and starts the service on the first connection.",
+	Args: cobra.NoArgs,
+	RunE: runServiceInstall,
+}
+
+func runServiceInstall(cmd *cobra.Command, args []string) error {
+	if !serviceUser {
+		return errors.New("only user units are supported; pass --user (run 'loginctl enable-linger' to start it at boot)")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding pidge binary: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("finding pidge binary: %w", err)
+	}
+	cfgPath, err := resolveConfigPath()
+	if err != nil {
+		return err
+	}
+	if cfgPath, err = filepath.Abs(cfgPath); err != nil {
+		return err
+	}
+	dbDir, err := filepath.Abs(filepath.Dir(cfg.ExpandDBPath()))
+	if err != nil {
+		return err
+	}
+
+	units := map[string]string{
+		"pidge.service": serviceUnit(exe, cfgPath, dbDir),
+	}
+	names := []string{"pidge.service"}
+	if serviceSocket {
+		stream, err := listenStream(cfg.Server.Listen)
+		if err != nil {
+			return err
+		}
+		units["pidge.socket"] = socketUnit(stream)
+		names = append(names, "pidge.socket")
+	}
+
+	if servicePrint {
+		for i, name := range names {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n%s", name, units[name])
+		}
+		return nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+	unitDir := filepath.Join(configDir, "systemd", "user")
+	if err := os.MkdirAll(unitDir, 0o755); err != nil {
+		return fmt.Errorf("creating unit directory: %w", err)
+	}
+
+	var written []string
+	for _, name := range names {
+		path := filepath.Join(unitDir, name)
+		if _, err := os.Stat(path); err == nil && !serviceForce {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+		}
+		if err := os.WriteFile(path, []byte(units[name]), 0o644); err != nil {
+			return fmt.Errorf("writing unit: %w", err)
+		}
+		written = append(written, path)
+	}
+
+	start := "pidge.service"
+	if serviceSocket {
+		start = "pidge.socket"
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]any{"units": written, "enable": start})
+	}
+
+	for _, path := range written {
+		fmt.Printf("Wrote %s\n", path)
+	}
+	fmt.Println()
+	fmt.Println("Enable it with:")
+	fmt.Println("  systemctl --user daemon-reload")
+	fmt.Printf("  systemctl --user enable --now %s\n", start)
+	return nil
+}
+
+// serviceUnit renders the pidge.service unit. pidge notifies systemd once
+// the store is open and the listener bound, and feeds the watchdog.
+func serviceUnit(exe, cfgPath, dbDir string) string {
+	run := systemdQuote(exe) + " --config " + systemdQuote(cfgPath)
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=pidge SMS webhook receiver and REST API\n")
+	b.WriteString("Documentation=https://github.com/typhonius/pidge\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=notify\n")
+	fmt.Fprintf(&b, "ExecStart=%s serve\n", run)
+	fmt.Fprintf(&b, "ExecReload=%s reload\n", run)
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5s\n")
+	b.WriteString("WatchdogSec=30s\n")
+	b.WriteString("TimeoutStopSec=15s\n")
+	if c := cfg.Gateway.PasswordCredential; c != "" {
+		fmt.Fprintf(&b, "# LoadCredential=%s:/path/to/gateway-password\n", c)
+	}
+	if c := cfg.Server.WebhookSecretCredential; c != "" {
+		fmt.Fprintf(&b, "# LoadCredential=%s:/path/to/webhook-secret\n", c)
+	}
+	b.WriteString("\n# Hardening\n")
+	b.WriteString("NoNewPrivileges=yes\n")
+	b.WriteString("ProtectSystem=strict\n")
+	b.WriteString("ProtectHome=read-only\n")
+	fmt.Fprintf(&b, "ReadWritePaths=%s %%t\n", systemdQuote(dbDir))
+	b.WriteString("PrivateTmp=yes\n")
+	b.WriteString("PrivateDevices=yes\n")
+	b.WriteString("ProtectKernelTunables=yes\n")
+	b.WriteString("ProtectKernelModules=yes\n")
+	b.WriteString("ProtectKernelLogs=yes\n")
+	b.WriteString("ProtectControlGroups=yes\n")
+	b.WriteString("ProtectClock=yes\n")
+	b.WriteString("ProtectHostname=yes\n")
+	b.WriteString("RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6\n")
+	b.WriteString("RestrictNamespaces=yes\n")
+	b.WriteString("RestrictRealtime=yes\n")
+	b.WriteString("RestrictSUIDSGID=yes\n")
+	b.WriteString("LockPersonality=yes\n")
+	b.WriteString("MemoryDenyWriteExecute=yes\n")
+	b.WriteString("SystemCallArchitectures=native\n")
+	b.WriteString("SystemCallFilter=@system-service\n")
+	b.WriteString("SystemCallFilter=~@privileged @resources\n")
+	b.WriteString("CapabilityBoundingSet=\n")
+	b.WriteString("UMask=0077\n")
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+	return b.String()
+}
+
+// socketUnit renders the pidge.socket unit listening on stream.
+func socketUnit(stream string) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=pidge SMS webhook receiver and REST API socket\n")
+	b.WriteString("\n[Socket]\n")
+	fmt.Fprintf(&b, "ListenStream=%s\n", stream)
+	b.WriteString("NoDelay=yes\n")
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=sockets.target\n")
+	return b.String()
+}
+
+// listenStream converts a Go listen address to a ListenStream= value. A
+// missing host (":3851") listens on all addresses, as it does for Go.
+func listenStream(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("listen address %q: %w", addr, err)
+	}
+	if host == "" {
+		return port, nil
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// systemdQuote escapes specifiers in s and quotes it for a unit file if it
+// contains spaces or quotes.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -1,23 +1,72 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/devicesettings"
+)
+
+var (
+	settingsApplyYes    bool
+	settingsApplyDryRun bool
 )
 
 func init() {
+	settingsApplyCmd.Flags().BoolVarP(&settingsApplyYes, "yes", "y", false, "apply without asking for confirmation")
+	settingsApplyCmd.Flags().BoolVar(&settingsApplyDryRun, "dry-run", false, "show the changes without applying them")
+	settingsCmd.AddCommand(settingsSetCmd, settingsApplyCmd, settingsExportCmd, settingsKeysCmd)
 	rootCmd.AddCommand(settingsCmd)
 }
 
 var settingsCmd = &cobra.Command{
 	Use:   "settings",
-	Short: "View device settings",
+	Short: "View and change device settings",
+	Args:  cobra.NoArgs,
 	RunE:  runSettings,
 }
 
+var settingsSetCmd = &cobra.Command{
+	Use:   "set <section.key=value>...",
+	Short: "Change device settings",
+	Long: "Change one or more device settings, e.g.\n\n" +
+		"  pidge settings set messages.limit_value=100 webhooks.retry_count=5\n\n" +
+		"Run 'pidge settings keys' for the list of settings.",
+	Args: cobra.MinimumNArgs(1),
+	RunE: runSettingsSet,
+}
+
+var settingsApplyCmd = &cobra.Command{
+	Use:   "apply <file.toml>",
+	Short: "Apply device settings from a TOML file",
+	Long: "Compare the settings in a TOML file, as written by 'pidge settings export', with the device,\n" +
+		"show what would change and apply it after confirmation. Settings not in the file are left alone.",
+	Args: cobra.ExactArgs(1),
+	RunE: runSettingsApply,
+}
+
+var settingsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print device settings as TOML",
+	Long: "Print the device's settings as TOML for 'pidge settings apply'. Secrets such as the\n" +
+		"encryption passphrase are never returned by the gateway and are left out.",
+	Args: cobra.NoArgs,
+	RunE: runSettingsExport,
+}
+
+var settingsKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "List the settings that can be changed",
+	Args:  cobra.NoArgs,
+	RunE:  runSettingsKeys,
+}
+
 func runSettings(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -86,3 +135,169 @@ func runSettings(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func runSettingsSet(cmd *cobra.Command, args []string) error {
+	desired := make(devicesettings.Values)
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("%q: expected section.key=value", arg)
+		}
+		if err := desired.Set(strings.TrimSpace(key), value); err != nil {
+			return err
+		}
+	}
+	cmd.SilenceUsage = true
+	return applySettings(desired, false, true)
+}
+
+func runSettingsApply(cmd *cobra.Command, args []string) error {
+	var sections map[string]map[string]any
+	if _, err := toml.DecodeFile(args[0], &sections); err != nil {
+		return fmt.Errorf("reading %s: %w", args[0], err)
+	}
+	desired, err := devicesettings.FromSections(sections)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	cmd.SilenceUsage = true
+	return applySettings(desired, settingsApplyDryRun, settingsApplyYes)
+}
+
+// applySettings shows how desired differs from the device's settings and,
+// unless dryRun, updates the settings that differ, asking first unless yes.
+func applySettings(desired devicesettings.Values, dryRun, yes bool) error {
+	if _, err := desired.Settings(); err != nil {
+		return err
+	}
+
+	fetchCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	settings, err := client.GetSettings(fetchCtx)
+	if err != nil {
+		return fmt.Errorf("fetching settings: %w", err)
+	}
+	current, err := devicesettings.FromSettings(settings)
+	if err != nil {
+		return err
+	}
+	changes := devicesettings.Diff(current, desired)
+
+	if !jsonOutput {
+		if len(changes) == 0 {
+			fmt.Println("Settings already up to date.")
+			return nil
+		}
+		printSettingsChanges(changes)
+	}
+	if dryRun || len(changes) == 0 {
+		if jsonOutput {
+			return printJSON(map[string]any{"changes": maskChanges(changes), "applied": false})
+		}
+		return nil
+	}
+
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Apply %d change(s)?", len(changes)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	patch, err := desired.Only(devicesettings.ChangedKeys(changes)).Settings()
+	if err != nil {
+		return err
+	}
+	// The prompt can take any amount of time, so the update gets its own
+	// timeout.
+	updateCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	updated, err := client.UpdateSettings(updateCtx, patch)
+	if err != nil {
+		return fmt.Errorf("updating settings: %w", err)
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]any{"changes": maskChanges(changes), "applied": true, "settings": updated})
+	}
+	fmt.Printf("Updated %d setting(s).\n", len(changes))
+	return nil
+}
+
+func printSettingsChanges(changes []devicesettings.Change) {
+	width := 0
+	for _, c := range changes {
+		width = max(width, len(c.Key))
+	}
+	for _, c := range changes {
+		fmt.Printf("  %-*s  %s -> %s\n", width, c.Key,
+			devicesettings.Format(c.Key, c.From), devicesettings.Format(c.Key, c.To))
+	}
+}
+
+// maskChanges replaces secret values in changes for output.
+func maskChanges(changes []devicesettings.Change) []devicesettings.Change {
+	masked := make([]devicesettings.Change, len(changes))
+	for i, c := range changes {
+		if devicesettings.IsSecret(c.Key) {
+			c.From, c.To = nil, devicesettings.Format(c.Key, c.To)
+		}
+		masked[i] = c
+	}
+	return masked
+}
+
+// confirm asks a yes/no question on the terminal. It fails if stdin isn't a
+// terminal, so scripts must pass --yes.
+func confirm(question string) (bool, error) {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false, fmt.Errorf("not a terminal; pass --yes to confirm")
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func runSettingsExport(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	settings, err := client.GetSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching settings: %w", err)
+	}
+	values, err := devicesettings.FromSettings(settings)
+	if err != nil {
+		return err
+	}
+	for key := range values {
+		if devicesettings.IsSecret(key) {
+			delete(values, key)
+		}
+	}
+
+	if jsonOutput {
+		return printJSON(values.Sections())
+	}
+	fmt.Printf("# Gateway settings exported by pidge on %s.\n", time.Now().Format(time.RFC3339))
+	fmt.Println("# Apply with: pidge settings apply <file>")
+	fmt.Println()
+	return toml.NewEncoder(os.Stdout).Encode(values.Sections())
+}
+
+func runSettingsKeys(cmd *cobra.Command, args []string) error {
+	keys := devicesettings.Keys()
+	if jsonOutput {
+		return printJSON(keys)
+	}
+	for _, k := range keys {
+		fmt.Println(k)
+	}
+	return nil
+}
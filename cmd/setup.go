@@ -3,6 +3,7 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -13,7 +14,17 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	setupPasswordFile       string
+	setupPasswordCommand    string
+	setupPasswordCredential string
+)
+
 func init() {
+	setupCmd.Flags().StringVar(&setupPasswordFile, "password-file", "", "save a reference to this file instead of the password")
+	setupCmd.Flags().StringVar(&setupPasswordCommand, "password-command", "", "save a command that prints the password (e.g. 'pass show sms')")
+	setupCmd.Flags().StringVar(&setupPasswordCredential, "password-credential", "", "save a systemd credential name instead of the password")
+	setupCmd.MarkFlagsMutuallyExclusive("password-file", "password-command", "password-credential")
 	rootCmd.AddCommand(setupCmd)
 }
 
@@ -30,9 +41,47 @@ func runSetup(cmd *cobra.Command, args []string) error {
 	fmt.Println("pidge setup")
 	fmt.Println()
 
+	path, err := resolveConfigPath()
+	if err != nil {
+		return err
+	}
+
+	// Keep the rest of an existing config, such as [server], max_segments
+	// and [gateway.settings]; only the connection details are replaced.
+	c2, err := config.LoadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		c2 = &config.Config{}
+	}
+
 	url := prompt(reader, "Gateway URL", "http://192.168.1.1:8080")
 	user := prompt(reader, "Username", "admin")
-	pass := prompt(reader, "Password", "")
+	c2.Gateway.URL = url
+	c2.Gateway.Username = user
+
+	if setupPasswordFile != "" || setupPasswordCommand != "" || setupPasswordCredential != "" {
+		c2.Gateway.Password = ""
+		c2.Gateway.PasswordFile = setupPasswordFile
+		c2.Gateway.PasswordCommand = setupPasswordCommand
+		c2.Gateway.PasswordCredential = setupPasswordCredential
+	}
+
+	var pass string
+	gw := c2.Gateway
+	if gw.PasswordFile == "" && gw.PasswordCommand == "" && gw.PasswordCredential == "" {
+		pass = prompt(reader, "Password", "")
+		c2.Gateway.Password = pass
+	} else {
+		// Resolve the reference now so the connection test uses the real
+		// password, but only the reference is saved.
+		resolved := &config.Config{Gateway: gw}
+		if err := resolved.ResolveSecrets(); err != nil {
+			return err
+		}
+		pass = resolved.Gateway.Password
+	}
 
 	fmt.Println()
 	fmt.Print("Testing connection... ")
@@ -52,22 +101,6 @@ func runSetup(cmd *cobra.Command, args []string) error {
 	}
 	fmt.Printf("OK (version %s, status %s)\n", health.Version, health.Status)
 
-	path := configPath
-	if path == "" {
-		p, err := config.DefaultPath()
-		if err != nil {
-			return err
-		}
-		path = p
-	}
-
-	c2 := &config.Config{
-		Gateway: config.GatewayConfig{
-			URL:      url,
-			Username: user,
-			Password: pass,
-		},
-	}
 	if err := c2.Save(path); err != nil {
 		return fmt.Errorf("saving config: %w", err)
 	}
@@ -3,29 +3,61 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
+	"github.com/android-sms-gateway/client-go/smsgateway"
 	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/e2e"
+)
+
+var (
+	statusWait             bool
+	statusTimeout          time.Duration
+	statusNoDeliveryReport bool
+)
+
+// Poll intervals while waiting for delivery. The interval doubles while
+// nothing changes.
+const (
+	minPollInterval = time.Second
+	maxPollInterval = 15 * time.Second
 )
 
 func init() {
+	statusCmd.Flags().BoolVar(&statusWait, "wait", false, "wait until every recipient is Delivered or Failed")
+	statusCmd.Flags().DurationVar(&statusTimeout, "timeout", 5*time.Minute, "how long --wait waits")
+	statusCmd.Flags().BoolVar(&statusNoDeliveryReport, "no-delivery-report", false, "the message was sent without a delivery report, so --wait stops at Sent")
 	rootCmd.AddCommand(statusCmd)
 }
 
 var statusCmd = &cobra.Command{
 	Use:   "status <message-id>",
 	Short: "Check message delivery status",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runStatus,
+	Long: "Show a sent message's delivery state. With --wait, poll the gateway until every recipient\n" +
+		"is Delivered or Failed, printing each change, and exit non-zero if any failed or the\n" +
+		"timeout passes first. For messages sent with --no-delivery-report, pass it here too:\n" +
+		"they never get past Sent.",
+	Args: cobra.ExactArgs(1),
+	RunE: runStatus,
 }
 
 func runStatus(cmd *cobra.Command, args []string) error {
 	id := args[0]
 
+	if statusWait {
+		cmd.SilenceUsage = true
+		done := isDelivered
+		if statusNoDeliveryReport {
+			done = isSent
+		}
+		return waitForDelivery(id, statusTimeout, done)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	state, err := client.GetState(ctx, id)
+	state, err := messageState(ctx, id)
 	if err != nil {
 		return fmt.Errorf("getting message state: %w", err)
 	}
@@ -46,3 +78,131 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
+
+// messageState fetches a sent message's state from the pidge server in
+// remote mode, otherwise from the gateway, decrypting it if needed.
+func messageState(ctx context.Context, id string) (smsgateway.MessageState, error) {
+	if pc := remoteClient(); pc != nil {
+		m, err := pc.MessageState(ctx, id)
+		if err != nil {
+			return smsgateway.MessageState{}, err
+		}
+		return gatewayState(*m), nil
+	}
+
+	state, err := client.GetState(ctx, id)
+	if err != nil {
+		return state, err
+	}
+	e2e.DecryptState(cfg.Gateway.EncryptionPassphrase, &state)
+	return state, nil
+}
+
+// isDelivered reports whether a recipient has reached Delivered or Failed.
+func isDelivered(s smsgateway.ProcessingState) bool {
+	return s == smsgateway.ProcessingStateDelivered || s == smsgateway.ProcessingStateFailed
+}
+
+// isSent reports whether a recipient has been sent, or failed. It's the
+// final state for messages sent without a delivery report.
+func isSent(s smsgateway.ProcessingState) bool {
+	return s == smsgateway.ProcessingStateSent || isDelivered(s)
+}
+
+// waitForDelivery polls message id until done is true for every recipient,
+// printing each state change. It fails if any recipient failed or timeout
+// passes first.
+func waitForDelivery(id string, timeout time.Duration, done func(smsgateway.ProcessingState) bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	seen := make(map[string]smsgateway.ProcessingState)
+	interval := minPollInterval
+	var state smsgateway.MessageState
+	for {
+		var err error
+		state, err = messageState(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			fmt.Fprintf(os.Stderr, "Warning: getting message state: %v\n", err)
+		} else {
+			if printTransitions(state, seen) {
+				interval = minPollInterval
+			}
+			if allRecipients(state, done) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+			interval = min(interval*2, maxPollInterval)
+			continue
+		}
+		break
+	}
+
+	if jsonOutput && state.ID != "" {
+		if err := printJSON(state); err != nil {
+			return err
+		}
+	}
+
+	if !allRecipients(state, done) {
+		return fmt.Errorf("timed out after %s waiting for message %s (state %s)", timeout, id, state.State)
+	}
+	failed := 0
+	for _, r := range state.Recipients {
+		if r.State == smsgateway.ProcessingStateFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("delivery failed for %d of %d recipient(s)", failed, len(state.Recipients))
+	}
+	return nil
+}
+
+// allRecipients reports whether done holds for every recipient of state.
+func allRecipients(state smsgateway.MessageState, done func(smsgateway.ProcessingState) bool) bool {
+	if len(state.Recipients) == 0 {
+		return false
+	}
+	for _, r := range state.Recipients {
+		if !done(r.State) {
+			return false
+		}
+	}
+	return true
+}
+
+// printTransitions prints recipients whose state differs from seen, updating
+// it, and reports whether anything changed. Nothing is printed with --json.
+func printTransitions(state smsgateway.MessageState, seen map[string]smsgateway.ProcessingState) bool {
+	changed := false
+	for _, r := range state.Recipients {
+		prev, ok := seen[r.PhoneNumber]
+		if ok && prev == r.State {
+			continue
+		}
+		seen[r.PhoneNumber] = r.State
+		changed = true
+		if jsonOutput {
+			continue
+		}
+
+		line := fmt.Sprintf("%s  %s: ", time.Now().Format("15:04:05"), r.PhoneNumber)
+		if ok {
+			line += fmt.Sprintf("%s -> ", prev)
+		}
+		line += string(r.State)
+		if r.Error != nil {
+			line += fmt.Sprintf(" (error: %s)", *r.Error)
+		}
+		fmt.Println(line)
+	}
+	return changed
+}
@@ -1,65 +1,108 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"strconv"
-	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/control"
 )
 
+var stopDB string
+
 func init() {
+	stopCmd.Flags().StringVar(&stopDB, "db", "", "database path of the instance to stop (default from config)")
 	rootCmd.AddCommand(stopCmd)
 }
 
 var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "Stop a running pidge server",
-	Long:  "Send SIGTERM to the running pidge serve process for a graceful shutdown.",
-	RunE:  runStop,
+	Long: "Gracefully stop the pidge serve instance using the configured database (or --db).\n" +
+		"The server is asked via its control socket; if that is unavailable, SIGTERM is sent to the PID in its\n" +
+		"PID file, but only while that server still holds the file's lock.",
+	Args: cobra.NoArgs,
+	RunE: runStop,
 }
 
-func runStop(cmd *cobra.Command, args []string) error {
-	entries, err := os.ReadDir("/proc")
-	if err != nil {
-		return fmt.Errorf("reading /proc: %w", err)
+// instanceDBPath returns the database path identifying the serve instance to
+// control: the override if given, otherwise the configured db_path.
+func instanceDBPath(override string) string {
+	if override != "" {
+		return override
 	}
+	return cfg.ExpandDBPath()
+}
 
-	myPID := os.Getpid()
-	found := false
+func runStop(cmd *cobra.Command, args []string) error {
+	dbPath := instanceDBPath(stopDB)
+	pid, _ := control.ReadPID(dbPath)
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+	_, err := control.Call(dbPath, control.Request{Command: control.CmdStop})
+	switch {
+	case err == nil:
+	case errors.Is(err, control.ErrNotRunning):
+		if pid == 0 {
+			return fmt.Errorf("no running pidge serve found for %s", dbPath)
 		}
-		pid, err := strconv.Atoi(entry.Name())
-		if err != nil || pid == myPID {
-			continue
+		// The socket is gone but a PID file remains. Only signal the PID
+		// while the server still holds the file's lock: otherwise it may
+		// have been reused by an unrelated process.
+		held, err := control.PIDFileHeld(dbPath)
+		if err != nil {
+			return fmt.Errorf("no running pidge serve found for %s (cannot verify pid file for %d: %v)", dbPath, pid, err)
 		}
-
-		cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+		if !held {
+			return fmt.Errorf("no running pidge serve found for %s (stale pid file for %d; not signalling it)", dbPath, pid)
+		}
+		proc, err := os.FindProcess(pid)
 		if err != nil {
-			continue
+			return fmt.Errorf("finding pid %d: %w", pid, err)
 		}
-
-		parts := strings.Split(string(cmdline), "\x00")
-		if len(parts) >= 2 && strings.HasSuffix(parts[0], "pidge") && parts[1] == "serve" {
-			proc, err := os.FindProcess(pid)
-			if err != nil {
-				continue
-			}
-			if err := proc.Signal(syscall.SIGTERM); err != nil {
-				return fmt.Errorf("sending SIGTERM to pid %d: %w", pid, err)
-			}
-			fmt.Printf("Sent SIGTERM to pidge serve (pid %d)\n", pid)
-			found = true
+		if err := proc.Signal(syscall.SIGTERM); err != nil {
+			return fmt.Errorf("no running pidge serve found for %s (stale pid file for %d: %v)", dbPath, pid, err)
 		}
+	default:
+		return fmt.Errorf("stopping server: %w", err)
+	}
+	if err := waitForExit(dbPath, pid, 15*time.Second); err != nil {
+		return err
 	}
 
-	if !found {
-		return fmt.Errorf("no running pidge serve process found")
+	if jsonOutput {
+		return printJSON(map[string]any{"status": "stopped", "pid": pid, "db": dbPath})
 	}
+
+	fmt.Printf("Stopped pidge serve (pid %d, db %s)\n", pid, dbPath)
 	return nil
 }
+
+// waitForExit waits for the server to release its PID file lock or, where
+// files can't be locked, to stop answering on its control socket. It fails
+// if the server is still running after timeout.
+func waitForExit(dbPath string, pid int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for serverRunning(dbPath) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("pidge serve (pid %d) is still running %s after being asked to stop", pid, timeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return nil
+}
+
+func serverRunning(dbPath string) bool {
+	held, err := control.PIDFileHeld(dbPath)
+	switch {
+	case err == nil:
+		return held
+	case errors.Is(err, fs.ErrNotExist):
+		return false
+	}
+	_, err = control.Call(dbPath, control.Request{Command: control.CmdStatus})
+	return !errors.Is(err, control.ErrNotRunning)
+}
@@ -2,11 +2,22 @@ package cmd
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/android-sms-gateway/client-go/smsgateway"
 	"github.com/spf13/cobra"
+	"github.com/typhonius/pidge/internal/config"
+	"github.com/typhonius/pidge/internal/webhooks"
+)
+
+var (
+	rotateExpireOld time.Duration
+	syncDryRun      bool
 )
 
 func init() {
@@ -14,6 +25,11 @@ func init() {
 	webhooksCmd.AddCommand(webhooksListCmd)
 	webhooksCmd.AddCommand(webhooksAddCmd)
 	webhooksCmd.AddCommand(webhooksDeleteCmd)
+	webhooksCmd.AddCommand(webhooksRotateSecretCmd)
+	webhooksCmd.AddCommand(webhooksSyncCmd)
+
+	webhooksSyncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "show what would change without changing it")
+	webhooksRotateSecretCmd.Flags().DurationVar(&rotateExpireOld, "expire-old", 0, "expire existing secrets after this long (default: keep them until removed)")
 }
 
 var webhooksCmd = &cobra.Command{
@@ -43,6 +59,27 @@ var webhooksDeleteCmd = &cobra.Command{
 	RunE:  runWebhooksDelete,
 }
 
+var webhooksRotateSecretCmd = &cobra.Command{
+	Use:   "rotate-secret",
+	Short: "Generate a new webhook signing secret",
+	Long: "Generate a new webhook signing secret and add it to webhook_secrets in the config file.\n\n" +
+		"Existing secrets stay valid (until --expire-old elapses, if given), so the phone can be\n" +
+		"switched over to the new secret without losing messages. Restart 'pidge serve' afterwards.",
+	Args: cobra.NoArgs,
+	RunE: runWebhooksRotateSecret,
+}
+
+var webhooksSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Register the configured webhooks and remove stale ones",
+	Long: "Make the gateway's webhooks match webhook_url and webhook_events: register missing\n" +
+		"subscriptions and delete webhooks registered by pidge for other URLs or events.\n" +
+		"Webhooks added by other means are left alone. 'pidge serve' does this on startup\n" +
+		"when auto_register is true.",
+	Args: cobra.NoArgs,
+	RunE: runWebhooksSync,
+}
+
 func runWebhooksList(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -113,3 +150,127 @@ func runWebhooksDelete(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Webhook %s deleted.\n", id)
 	return nil
 }
+
+func runWebhooksRotateSecret(cmd *cobra.Command, args []string) error {
+	path, err := resolveConfigPath()
+	if err != nil {
+		return err
+	}
+
+	// Edit the file as written so defaults and env overrides aren't persisted.
+	fileCfg, err := config.LoadFile(path)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("generating secret: %w", err)
+	}
+	secret := hex.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	var expires time.Time
+	if rotateExpireOld > 0 {
+		expires = now.Add(rotateExpireOld).Truncate(time.Second)
+	}
+
+	var secrets []config.WebhookSecret
+	for _, s := range fileCfg.AllWebhookSecrets() {
+		if !s.Expires.IsZero() && now.After(s.Expires) {
+			continue // drop secrets that have already expired
+		}
+		if !expires.IsZero() && (s.Expires.IsZero() || s.Expires.After(expires)) {
+			s.Expires = expires
+		}
+		secrets = append(secrets, s)
+	}
+	secrets = append(secrets, config.WebhookSecret{Secret: secret})
+
+	fileCfg.Server.WebhookSecret = ""
+	fileCfg.Server.WebhookSecrets = secrets
+	if err := fileCfg.Save(path); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+
+	if jsonOutput {
+		out := map[string]any{"secret": secret, "config": path}
+		if !expires.IsZero() {
+			out["oldSecretsExpire"] = expires
+		}
+		return printJSON(out)
+	}
+
+	fmt.Printf("New webhook secret added to %s:\n\n  %s\n\n", path, secret)
+	if len(secrets) > 1 {
+		if expires.IsZero() {
+			fmt.Printf("The %d previous secret(s) remain valid until removed from webhook_secrets.\n", len(secrets)-1)
+		} else {
+			fmt.Printf("The %d previous secret(s) expire at %s.\n", len(secrets)-1, expires.Local().Format(time.RFC3339))
+		}
+	}
+	fmt.Println("\nNext steps:")
+	fmt.Println("  1. Restart 'pidge serve' so it accepts the new secret.")
+	fmt.Println("  2. On the phone, open SMS Gateway > Settings > Webhooks > Signing Key")
+	fmt.Println("     and replace the key with the secret above.")
+	fmt.Println("  3. Once messages arrive signed with the new key, remove the old")
+	fmt.Println("     entries from webhook_secrets (or let them expire).")
+	if os.Getenv("PIDGE_WEBHOOK_SECRET") != "" {
+		fmt.Println("\nWarning: PIDGE_WEBHOOK_SECRET is set and is accepted in addition to the config file secrets.")
+	}
+	return nil
+}
+
+// previousWebhookURLs returns the webhook URL 'pidge serve' last registered,
+// if the database records one.
+func previousWebhookURLs() []string {
+	st, err := openStoreReadOnly(cfg.ExpandDBPath())
+	if err != nil {
+		return nil
+	}
+	defer st.Close()
+	if url, err := st.WebhookURL(); err == nil && url != "" {
+		return []string{url}
+	}
+	return nil
+}
+
+func runWebhooksSync(cmd *cobra.Command, args []string) error {
+	if cfg.Server.WebhookURL == "" {
+		return errors.New("webhook_url is not set in the [server] config")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	actions, err := webhooks.Sync(ctx, client, cfg.Server.WebhookURL, cfg.Server.WebhookEvents, previousWebhookURLs(), syncDryRun)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(map[string]any{"dryRun": syncDryRun, "actions": actions})
+	}
+
+	changed := 0
+	for _, a := range actions {
+		verb := map[string]string{"add": "Register", "adopt": "Adopt", "delete": "Delete", "keep": "Keep"}[a.Op]
+		if !syncDryRun {
+			verb = map[string]string{"add": "Registered", "adopt": "Adopted", "delete": "Deleted", "keep": "Kept"}[a.Op]
+		}
+		if a.Op != "keep" {
+			changed++
+		}
+		id := a.ID
+		if id == "" {
+			id = a.Replaces
+		}
+		fmt.Printf("%-10s  %-36s  %-20s  %s\n", verb, id, a.Event, a.URL)
+	}
+	if changed == 0 {
+		fmt.Println("Webhooks already in sync.")
+	} else if syncDryRun {
+		fmt.Printf("%d change(s) pending; run without --dry-run to apply.\n", changed)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	webhookTestURL  string
+	webhookTestKeep bool
+)
+
+func init() {
+	webhooksTestCmd.Flags().StringVar(&webhookTestURL, "url", "", "URL to test (default: webhook_url from config)")
+	webhooksTestCmd.Flags().BoolVar(&webhookTestKeep, "keep", false, "leave the test message in the database")
+	webhooksCmd.AddCommand(webhooksTestCmd)
+}
+
+var webhooksTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Send a signed test message to the webhook URL",
+	Long: "POST a synthetic sms:received webhook, signed like the gateway signs them, to webhook_url\n" +
+		"and check each step on the way: DNS, connection, TLS certificate, HTTP status, signature\n" +
+		"and storage. The test message is deleted from the local database afterwards.",
+	Args: cobra.NoArgs,
+	RunE: runWebhooksTest,
+}
+
+func runWebhooksTest(cmd *cobra.Command, args []string) error {
+	target := webhookTestURL
+	if target == "" {
+		target = cfg.Server.WebhookURL
+	}
+	if target == "" {
+		return errors.New("webhook_url is not set in the [server] config (or pass --url)")
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", target)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report := &checkReport{}
+	testWebhook(ctx, report, u)
+
+	if jsonOutput {
+		printJSON(report)
+	} else {
+		report.print()
+	}
+
+	if f := report.failed(); f != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("webhook test failed at %s", f.Name)
+	}
+	return nil
+}
+
+// testWebhook runs each stage against u, stopping at the first failure.
+func testWebhook(ctx context.Context, report *checkReport, u *url.URL) {
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"https": "443", "http": "80"}[u.Scheme]
+	}
+
+	// DNS
+	if net.ParseIP(host) != nil {
+		report.add("dns", checkSkip, "%s is an IP address", host)
+	} else {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			report.add("dns", checkFail, "cannot resolve %s: %v", host, err)
+			return
+		}
+		report.add("dns", checkPass, "%s resolves to %s", host, strings.Join(addrs, ", "))
+	}
+
+	// TCP
+	addr := net.JoinHostPort(host, port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		report.add("connect", checkFail, "cannot connect to %s: %v", addr, err)
+		return
+	}
+	conn.Close()
+	report.add("connect", checkPass, "connected to %s", addr)
+
+	// TLS, verified the way the phone will: against the system roots
+	if u.Scheme != "https" {
+		report.add("tls", checkWarn, "plain %s: the gateway app only delivers to https:// URLs", u.Scheme)
+	} else if !checkTLS(ctx, report, dialer, addr, host) {
+		return
+	}
+
+	// HTTP and signature
+	eventID, ok := postTestWebhook(ctx, report, u)
+	if !ok {
+		return
+	}
+
+	// Storage. Only look: a database that doesn't exist yet is left for
+	// 'pidge serve' to create.
+	dbPath := cfg.ExpandDBPath()
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		report.add("stored", checkSkip, "%s does not exist; not checking that the message was stored", dbPath)
+		return
+	}
+	st, err := openStoreReadOnly(dbPath)
+	if err != nil {
+		report.add("stored", checkWarn, "server accepted the message but the local database can't be checked: %v", err)
+		return
+	}
+	msg, err := st.GetMessageByEventID(eventID)
+	st.Close()
+	switch {
+	case err != nil:
+		report.add("stored", checkFail, "looking up test message: %v", err)
+	case msg == nil:
+		report.add("stored", checkWarn, "server accepted the message but it isn't in %s (is %s served by another pidge?)",
+			dbPath, u.Host)
+	case webhookTestKeep:
+		report.add("stored", checkPass, "stored as message %d (kept)", msg.ID)
+	default:
+		if err := deleteTestMessage(dbPath, msg.ID); err != nil {
+			report.add("stored", checkWarn, "stored as message %d but removing it failed: %v", msg.ID, err)
+			return
+		}
+		report.add("stored", checkPass, "stored as message %d, then removed", msg.ID)
+	}
+}
+
+// deleteTestMessage removes the test message from the database that the
+// running server just stored it in.
+func deleteTestMessage(dbPath string, id int64) error {
+	st, err := openStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	return st.DeleteMessage(id)
+}
+
+// checkTLS handshakes with addr and explains certificate problems in the
+// terms the gateway app fails on.
+func checkTLS(ctx context.Context, report *checkReport, dialer *net.Dialer, addr, host string) bool {
+	td := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+	conn, err := td.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		var unknown x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		var invalid x509.CertificateInvalidError
+		switch {
+		case errors.As(err, &unknown):
+			report.add("tls", checkFail, "certificate is not trusted (self-signed or private CA); the gateway app will reject it")
+		case errors.As(err, &hostname):
+			report.add("tls", checkFail, "certificate is not valid for %s", host)
+		case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+			report.add("tls", checkFail, "certificate has expired or is not yet valid")
+		default:
+			report.add("tls", checkFail, "handshake failed: %v", err)
+		}
+		return false
+	}
+	defer conn.Close()
+
+	leaf := conn.(*tls.Conn).ConnectionState().PeerCertificates[0]
+	left := time.Until(leaf.NotAfter)
+	if left < certExpiryWarning {
+		report.add("tls", checkWarn, "trusted certificate from %s expires in %s", leaf.Issuer.CommonName, roughDuration(left))
+		return true
+	}
+	report.add("tls", checkPass, "trusted certificate from %s, valid until %s", leaf.Issuer.CommonName, leaf.NotAfter.Format("2006-01-02"))
+	return true
+}
+
+// postTestWebhook sends a signed sms:received payload and reports the HTTP
+// and signature stages. It returns the event ID if the server stored it.
+func postTestWebhook(ctx context.Context, report *checkReport, u *url.URL) (string, bool) {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	eventID := "pidge-test-" + hex.EncodeToString(buf)
+
+	now := time.Now()
+	payload := map[string]any{
+		"id":       eventID,
+		"event":    "sms:received",
+		"deviceId": "pidge-test",
+		"payload": map[string]any{
+			"messageId":   eventID,
+			"message":     "pidge webhook test",
+			"phoneNumber": "+10000000000",
+			"simNumber":   1,
+			"receivedAt":  now.Format(time.RFC3339),
+		},
+	}
+	body, _ := json.Marshal(payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		report.add("http", checkFail, "%v", err)
+		return "", false
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Sign with the newest unexpired secret, which the phone should be using.
+	var secret string
+	for _, s := range cfg.AllWebhookSecrets() {
+		if s.Expires.IsZero() || now.Before(s.Expires) {
+			secret = s.Secret
+		}
+	}
+	signed := secret != ""
+	if signed {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		report.add("http", checkFail, "request failed: %v", err)
+		return "", false
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	text := strings.TrimSpace(string(respBody))
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		report.add("http", checkPass, "server responded %s", resp.Status)
+		switch {
+		case !signed:
+			report.add("signature", checkFail, "server requires a signature but no webhook secret is configured here")
+		case strings.Contains(text, "stale"):
+			report.add("signature", checkFail, "signature accepted but timestamp rejected; check the clocks agree")
+		default:
+			report.add("signature", checkFail, "server rejected the signature; its webhook secret differs from this config's")
+		}
+		return "", false
+	}
+	if resp.StatusCode != http.StatusOK {
+		report.add("http", checkFail, "server responded %s: %s", resp.Status, text)
+		return "", false
+	}
+
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil || result.Status != "stored" {
+		report.add("http", checkFail, "server responded %s but not like pidge: %s", resp.Status, text)
+		return "", false
+	}
+	report.add("http", checkPass, "server responded %s", resp.Status)
+	if signed {
+		report.add("signature", checkPass, "signature accepted")
+	} else {
+		report.add("signature", checkWarn, "no webhook secret configured; anyone who can reach the URL can inject messages")
+	}
+	return eventID, true
+}
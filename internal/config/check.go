@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/android-sms-gateway/client-go/smsgateway"
+)
+
+// FieldError is a problem with a single config key.
+type FieldError struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+// Check performs a thorough validation of the config, beyond the required
+// fields covered by Validate, and returns every problem found.
+func (c *Config) Check() []FieldError {
+	var errs []FieldError
+	add := func(key, format string, args ...any) {
+		errs = append(errs, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, k := range c.meta.Undecoded() {
+		add(k.String(), "unknown key")
+	}
+	if err := c.checkSecretRefs(); err != nil {
+		add("secrets", "%v", err)
+	}
+
+	// [gateway]
+	remoteOnly := c.Gateway.URL == "" && c.Client.ServerURL != ""
+	if c.Gateway.URL == "" {
+		if !remoteOnly {
+			add("gateway.url", "required (or set client.server_url)")
+		}
+	} else if u, err := url.Parse(c.Gateway.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		add("gateway.url", "must be an http:// or https:// URL")
+	}
+	if c.Gateway.Username == "" && !remoteOnly {
+		add("gateway.username", "required")
+	}
+	if c.Gateway.Password == "" && !remoteOnly {
+		add("gateway.password", "required (or set password_file, password_command or password_credential)")
+	}
+
+	if c.Gateway.MaxSegments < 0 {
+		add("gateway.max_segments", "must not be negative")
+	}
+
+	if _, err := c.DesiredSettings(); err != nil {
+		add("gateway.settings", "%s", strings.TrimPrefix(err.Error(), "gateway.settings: "))
+	}
+
+	// [server]
+	if _, port, err := net.SplitHostPort(c.Server.Listen); err != nil || port == "" {
+		add("server.listen", "must be host:port or :port")
+	}
+	if c.Server.WebhookURL != "" {
+		u, err := url.Parse(c.Server.WebhookURL)
+		switch {
+		case err != nil || u.Host == "":
+			add("server.webhook_url", "not a valid URL")
+		case u.Scheme != "https":
+			add("server.webhook_url", "the gateway only delivers to https:// URLs")
+		}
+	} else if c.Server.AutoRegister {
+		add("server.webhook_url", "required when auto_register is true")
+	}
+	for _, e := range c.Server.WebhookEvents {
+		if !smsgateway.IsValidWebhookEvent(e) {
+			add("server.webhook_events", "unknown event %q (valid: %s)", e, strings.Join(smsgateway.WebhookEventTypes(), ", "))
+		}
+	}
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		add("server.tls_cert", "tls_cert and tls_key must be set together")
+	}
+	for _, f := range []struct{ key, path string }{
+		{"server.tls_cert", c.Server.TLSCert},
+		{"server.tls_key", c.Server.TLSKey},
+		{"server.db_key_file", c.Server.DBKeyFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(expandHome(f.path)); err != nil {
+			add(f.key, "%v", err)
+		}
+	}
+	if c.Server.WebhookTolerance.Duration < 0 {
+		add("server.webhook_tolerance", "must be positive")
+	}
+	if c.Server.LogArchiveInterval.Duration < 0 {
+		add("server.log_archive_interval", "must be positive")
+	}
+	if c.Server.SettingsCheckInterval.Duration < 0 {
+		add("server.settings_check_interval", "must be positive")
+	}
+	if c.Server.HealthSampleInterval.Duration < 0 {
+		add("server.health_sample_interval", "must be positive")
+	}
+	if c.Server.HealthRetentionDays < 0 {
+		add("server.health_retention_days", "must be positive")
+	}
+	if c.Server.LogRetentionDays < 0 {
+		add("server.log_retention_days", "must not be negative")
+	}
+	if _, err := c.SlogLevel(); err != nil {
+		add("server.log_level", "must be debug, info, warn or error")
+	}
+	for i, s := range c.Server.WebhookSecrets {
+		if s.Secret == "" {
+			add(fmt.Sprintf("server.webhook_secrets[%d]", i), "secret is required")
+		}
+	}
+
+	// [client]
+	if v := c.Client.ServerURL; v != "" && v != "local" {
+		if u, err := url.Parse(v); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			add("client.server_url", "must be an http:// or https:// URL, or \"local\"")
+		}
+	}
+	return errs
+}
@@ -2,17 +2,88 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/typhonius/pidge/internal/devicesettings"
 )
 
+// DefaultWebhookTolerance is how far X-Timestamp may drift from the server
+// clock before a webhook is rejected.
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// DefaultWebhookEvent is subscribed to when webhook_events is unset.
+const DefaultWebhookEvent = "sms:received"
+
+// DefaultLogArchiveInterval is how often 'pidge serve' archives device logs
+// when archive_logs is set.
+const DefaultLogArchiveInterval = 15 * time.Minute
+
+// DefaultSettingsCheckInterval is how often 'pidge serve' checks the device's
+// settings against [gateway.settings].
+const DefaultSettingsCheckInterval = 15 * time.Minute
+
+// Defaults for recording gateway health history.
+const (
+	DefaultHealthSampleInterval = 5 * time.Minute
+	DefaultHealthRetentionDays  = 90
+)
+
+// Duration is a time.Duration that reads and writes as a string such as "5m"
+// in TOML.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a Go duration string.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalText formats the duration as a Go duration string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
 type GatewayConfig struct {
 	URL      string `toml:"url"`
 	Username string `toml:"username"`
 	Password string `toml:"password"`
+
+	// Alternatives to a plaintext password: a file, a command whose first
+	// line of output is the password, or a systemd credential name.
+	PasswordFile       string `toml:"password_file,omitempty"`
+	PasswordCommand    string `toml:"password_command,omitempty"`
+	PasswordCredential string `toml:"password_credential,omitempty"`
+
+	// EncryptionPassphrase enables end-to-end encryption. It must match the
+	// passphrase set in the gateway app.
+	EncryptionPassphrase string `toml:"encryption_passphrase,omitempty"`
+
+	// MaxSegments refuses to send messages that would split into more SMS
+	// than this. Zero means no limit.
+	MaxSegments int `toml:"max_segments,omitzero"`
+
+	// Settings is the desired state of the device's settings, one table per
+	// section, e.g. [gateway.settings.messages]. 'pidge serve' reports drift
+	// from it and, with enforce_settings, re-applies it.
+	Settings map[string]map[string]any `toml:"settings,omitempty"`
+}
+
+// WebhookSecret is one of several HMAC keys accepted during rotation.
+type WebhookSecret struct {
+	Secret string `toml:"secret"`
+	// Expires is when the secret stops being accepted. Zero means never.
+	Expires time.Time `toml:"expires,omitempty"`
 }
 
 type ServerConfig struct {
@@ -23,11 +94,75 @@ type ServerConfig struct {
 	WebhookURL    string `toml:"webhook_url"`
 	TLSCert       string `toml:"tls_cert"`
 	TLSKey        string `toml:"tls_key"`
+
+	// WebhookEvents are the gateway events subscribed to at webhook_url by
+	// auto_register and 'pidge webhooks sync'. Defaults to sms:received.
+	WebhookEvents []string `toml:"webhook_events,omitempty"`
+	// UnregisterOnShutdown removes pidge's webhooks when 'pidge serve'
+	// stops cleanly, so the phone doesn't queue deliveries while it's down.
+	UnregisterOnShutdown bool `toml:"unregister_on_shutdown,omitempty"`
+
+	// WebhookSecrets are additional accepted secrets, so the phone and server
+	// can be switched to a new secret at different times.
+	WebhookSecrets []WebhookSecret `toml:"webhook_secrets,omitempty"`
+
+	// Alternatives to a plaintext webhook_secret, as for the gateway password.
+	WebhookSecretFile       string `toml:"webhook_secret_file,omitempty"`
+	WebhookSecretCommand    string `toml:"webhook_secret_command,omitempty"`
+	WebhookSecretCredential string `toml:"webhook_secret_credential,omitempty"`
+
+	// WebhookTolerance bounds the age of a signed webhook's X-Timestamp.
+	// Signatures seen within this window are remembered and replays rejected.
+	// Zero means DefaultWebhookTolerance; the check cannot be turned off.
+	WebhookTolerance Duration `toml:"webhook_tolerance,omitempty"`
+
+	// LogLevel is the minimum level logged by 'pidge serve': debug, info,
+	// warn or error.
+	LogLevel string `toml:"log_level,omitempty"`
+
+	// DBKeyFile holds the key that encrypts message bodies and phone
+	// numbers at rest. PIDGE_DB_KEY takes precedence.
+	DBKeyFile string `toml:"db_key_file,omitempty"`
+
+	// ArchiveLogs has 'pidge serve' copy the gateway's device logs into the
+	// database every log_archive_interval, so they can be read after the
+	// phone discards them.
+	ArchiveLogs        bool     `toml:"archive_logs,omitempty"`
+	LogArchiveInterval Duration `toml:"log_archive_interval,omitempty"`
+	// LogRetentionDays deletes archived logs older than this many days.
+	// Zero keeps them forever.
+	LogRetentionDays int `toml:"log_retention_days,omitzero"`
+
+	// SettingsCheckInterval is how often 'pidge serve' compares the device's
+	// settings with [gateway.settings].
+	SettingsCheckInterval Duration `toml:"settings_check_interval,omitempty"`
+	// EnforceSettings re-applies [gateway.settings] when the device's
+	// settings drift from it, instead of only reporting it.
+	EnforceSettings bool `toml:"enforce_settings,omitempty"`
+
+	// HealthSampleInterval is how often 'pidge serve' records the gateway's
+	// health for 'pidge health --history'. Samples older than
+	// health_retention_days are deleted.
+	HealthSampleInterval Duration `toml:"health_sample_interval,omitempty"`
+	HealthRetentionDays  int      `toml:"health_retention_days,omitzero"`
+}
+
+// ClientConfig is for running the CLI on a machine other than the server.
+type ClientConfig struct {
+	// ServerURL makes inbox, send, status, health, ack and unack use this
+	// pidge server's API instead of the local database and the gateway, so
+	// no [gateway] credentials are needed. "local" means the server
+	// configured in [server].
+	ServerURL string `toml:"server_url,omitempty"`
 }
 
 type Config struct {
 	Gateway GatewayConfig `toml:"gateway"`
 	Server  ServerConfig  `toml:"server"`
+	Client  ClientConfig  `toml:"client,omitempty"`
+
+	// meta records which keys were present in the file.
+	meta toml.MetaData
 }
 
 // DefaultPath returns ~/.config/pidge/config.toml.
@@ -48,14 +183,42 @@ func DefaultDBPath() (string, error) {
 	return filepath.Join(home, ".config", "pidge", "pidge.db"), nil
 }
 
-// Load reads the config from path and merges env var overrides.
+// Load reads the config from path, merges env var overrides and resolves
+// secrets held in files, commands or systemd credentials.
 func Load(path string) (*Config, error) {
-	var cfg Config
-	if _, err := toml.DecodeFile(path, &cfg); err != nil {
-		return nil, fmt.Errorf("reading config: %w", err)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkSecretRefs(); err != nil {
+		return nil, err
 	}
 	cfg.applyDefaults()
 	cfg.applyEnv()
+	if err := cfg.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Empty returns a config holding only defaults and env overrides, for
+// commands run against a pidge server without a config file.
+func Empty() *Config {
+	var cfg Config
+	cfg.applyDefaults()
+	cfg.applyEnv()
+	return &cfg
+}
+
+// LoadFile reads the config from path exactly as written, without defaults
+// or env overrides, so it can be edited and saved back.
+func LoadFile(path string) (*Config, error) {
+	var cfg Config
+	meta, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	cfg.meta = meta
 	return &cfg, nil
 }
 
@@ -69,47 +232,125 @@ func (c *Config) applyDefaults() {
 			c.Server.DBPath = p
 		}
 	}
+	if c.Server.WebhookTolerance.Duration == 0 {
+		c.Server.WebhookTolerance.Duration = DefaultWebhookTolerance
+	}
+	if c.Server.LogArchiveInterval.Duration == 0 {
+		c.Server.LogArchiveInterval.Duration = DefaultLogArchiveInterval
+	}
+	if c.Server.SettingsCheckInterval.Duration == 0 {
+		c.Server.SettingsCheckInterval.Duration = DefaultSettingsCheckInterval
+	}
+	if c.Server.HealthSampleInterval.Duration == 0 {
+		c.Server.HealthSampleInterval.Duration = DefaultHealthSampleInterval
+	}
+	if c.Server.HealthRetentionDays == 0 {
+		c.Server.HealthRetentionDays = DefaultHealthRetentionDays
+	}
+	if len(c.Server.WebhookEvents) == 0 {
+		c.Server.WebhookEvents = []string{DefaultWebhookEvent}
+	}
 }
 
 // applyEnv overrides config values with environment variables if set.
 func (c *Config) applyEnv() {
-	if v := os.Getenv("PIDGE_URL"); v != "" {
-		c.Gateway.URL = v
+	for _, o := range envOverrides {
+		v := os.Getenv(o.env)
+		if v == "" {
+			continue
+		}
+		if f, err := c.Field(o.key); err == nil {
+			f.Set(v)
+		}
+	}
+}
+
+// Validate checks that required fields are present. The gateway's details
+// are optional when commands go through a pidge server instead.
+func (c *Config) Validate() error {
+	if c.Gateway.URL != "" || c.Client.ServerURL == "" {
+		if c.Gateway.URL == "" {
+			return fmt.Errorf("gateway URL is required")
+		}
+		if c.Gateway.Username == "" {
+			return fmt.Errorf("gateway username is required")
+		}
+		if c.Gateway.Password == "" {
+			return fmt.Errorf("gateway password is required")
+		}
 	}
-	if v := os.Getenv("PIDGE_USER"); v != "" {
-		c.Gateway.Username = v
+	for i, s := range c.Server.WebhookSecrets {
+		if s.Secret == "" {
+			return fmt.Errorf("webhook_secrets[%d]: secret is required", i)
+		}
 	}
-	if v := os.Getenv("PIDGE_PASS"); v != "" {
-		c.Gateway.Password = v
+	if _, err := c.DesiredSettings(); err != nil {
+		return err
 	}
-	if v := os.Getenv("PIDGE_LISTEN"); v != "" {
-		c.Server.Listen = v
+	return nil
+}
+
+// DesiredSettings returns [gateway.settings] as flat values, or nil if it's
+// empty.
+func (c *Config) DesiredSettings() (devicesettings.Values, error) {
+	if len(c.Gateway.Settings) == 0 {
+		return nil, nil
 	}
-	if v := os.Getenv("PIDGE_DB_PATH"); v != "" {
-		c.Server.DBPath = v
+	v, err := devicesettings.FromSections(c.Gateway.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("gateway.settings: %w", err)
 	}
-	if v := os.Getenv("PIDGE_WEBHOOK_SECRET"); v != "" {
-		c.Server.WebhookSecret = v
+	if _, err := v.Settings(); err != nil {
+		return nil, fmt.Errorf("gateway.settings: %w", err)
 	}
+	return v, nil
 }
 
-// Validate checks that required fields are present.
-func (c *Config) Validate() error {
-	if c.Gateway.URL == "" {
-		return fmt.Errorf("gateway URL is required")
+// AllWebhookSecrets returns webhook_secret followed by webhook_secrets,
+// including expired ones. Verification is enabled if this is non-empty.
+func (c *Config) AllWebhookSecrets() []WebhookSecret {
+	var secrets []WebhookSecret
+	if c.Server.WebhookSecret != "" {
+		secrets = append(secrets, WebhookSecret{Secret: c.Server.WebhookSecret})
+	}
+	secrets = append(secrets, c.Server.WebhookSecrets...)
+	return secrets
+}
+
+// SlogLevel parses log_level, defaulting to info.
+func (c *Config) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if c.Server.LogLevel == "" {
+		return slog.LevelInfo, nil
 	}
-	if c.Gateway.Username == "" {
-		return fmt.Errorf("gateway username is required")
+	if err := level.UnmarshalText([]byte(c.Server.LogLevel)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("log_level: %w", err)
 	}
-	if c.Gateway.Password == "" {
-		return fmt.Errorf("gateway password is required")
+	return level, nil
+}
+
+// DBKey returns the encoded at-rest encryption key from PIDGE_DB_KEY or
+// db_key_file, or "" if neither is set.
+func (c *Config) DBKey() (string, error) {
+	if v := os.Getenv("PIDGE_DB_KEY"); v != "" {
+		return v, nil
 	}
-	return nil
+	if c.Server.DBKeyFile == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(expandHome(c.Server.DBKeyFile))
+	if err != nil {
+		return "", fmt.Errorf("reading db_key_file: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
 }
 
 // ExpandDBPath resolves ~ in the DB path to the user's home directory.
 func (c *Config) ExpandDBPath() string {
-	p := c.Server.DBPath
+	return expandHome(c.Server.DBPath)
+}
+
+func expandHome(p string) string {
 	if strings.HasPrefix(p, "~/") {
 		if home, err := os.UserHomeDir(); err == nil {
 			p = filepath.Join(home, p[2:])
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/typhonius/pidge/internal/devicesettings"
+)
+
+// envOverrides maps config keys to the environment variables that override them.
+var envOverrides = []struct {
+	key string
+	env string
+}{
+	{"gateway.url", "PIDGE_URL"},
+	{"gateway.username", "PIDGE_USER"},
+	{"gateway.password", "PIDGE_PASS"},
+	{"gateway.encryption_passphrase", "PIDGE_ENCRYPTION_PASSPHRASE"},
+	{"server.listen", "PIDGE_LISTEN"},
+	{"server.db_path", "PIDGE_DB_PATH"},
+	{"server.webhook_secret", "PIDGE_WEBHOOK_SECRET"},
+	{"server.log_level", "PIDGE_LOG_LEVEL"},
+	{"client.server_url", "PIDGE_SERVER"},
+}
+
+// secretKeys are masked by 'pidge config show'.
+var secretKeys = map[string]bool{
+	"gateway.password":              true,
+	"gateway.encryption_passphrase": true,
+	"server.webhook_secret":         true,
+	"server.webhook_secrets":        true,
+}
+
+// Field is a single config value addressed by its dotted TOML key, such as
+// "server.listen".
+type Field struct {
+	Key    string
+	Env    string
+	Secret bool
+	value  reflect.Value
+}
+
+// Fields returns every value in the config in file order.
+func (c *Config) Fields() []Field {
+	env := make(map[string]string, len(envOverrides))
+	for _, o := range envOverrides {
+		env[o.key] = o.env
+	}
+
+	var fields []Field
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		if !root.Type().Field(i).IsExported() {
+			continue
+		}
+		section := tomlName(root.Type().Field(i))
+		sv := root.Field(i)
+		for j := 0; j < sv.NumField(); j++ {
+			key := section + "." + tomlName(sv.Type().Field(j))
+			fields = append(fields, Field{
+				Key:    key,
+				Env:    env[key],
+				Secret: secretKeys[key],
+				value:  sv.Field(j),
+			})
+		}
+	}
+	return fields
+}
+
+// Field looks up a value by its dotted key.
+func (c *Config) Field(key string) (Field, error) {
+	for _, f := range c.Fields() {
+		if f.Key == key {
+			return f, nil
+		}
+	}
+	return Field{}, fmt.Errorf("unknown config key %q", key)
+}
+
+// String formats the value as it would be written on the command line.
+func (f Field) String() string {
+	v := f.value
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, _ := m.MarshalText()
+		return string(b)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Slice:
+		if items, ok := v.Interface().([]string); ok {
+			return strings.Join(items, ",")
+		}
+		return fmt.Sprintf("[%d entries]", v.Len())
+	case reflect.Map:
+		if sections, ok := v.Interface().(map[string]map[string]any); ok {
+			return formatSettings(sections)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// formatSettings lists [gateway.settings] as sorted key=value pairs with
+// secrets masked.
+func formatSettings(sections map[string]map[string]any) string {
+	values, err := devicesettings.FromSections(sections)
+	if err != nil {
+		return fmt.Sprintf("[%d sections]", len(sections))
+	}
+	var pairs []string
+	for key, value := range values {
+		if devicesettings.IsSecret(key) {
+			value = "********"
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// IsZero reports whether the value is unset.
+func (f Field) IsZero() bool {
+	return f.value.IsZero()
+}
+
+// Equal reports whether the value is the same as o's, which must be the same
+// key read from another Config. Unlike comparing String, it sees changes
+// inside lists and secrets.
+func (f Field) Equal(o Field) bool {
+	return reflect.DeepEqual(f.value.Interface(), o.value.Interface())
+}
+
+// CopyFrom sets the value to o's, which must be the same key read from
+// another Config.
+func (f Field) CopyFrom(o Field) {
+	f.value.Set(o.value)
+}
+
+// Set parses s into the value.
+func (f Field) Set(s string) error {
+	v := f.value
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return fmt.Errorf("%s: %w", f.Key, err)
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%s: expected true or false", f.Key)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%s: expected a whole number", f.Key)
+		}
+		v.SetInt(int64(n))
+	case reflect.Slice:
+		if _, ok := v.Interface().([]string); !ok {
+			return fmt.Errorf("%s cannot be set from the command line; edit the config file", f.Key)
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s cannot be set from the command line; edit the config file", f.Key)
+	}
+	return nil
+}
+
+// Source reports where the field's current value came from: "env", "file",
+// the name of a secret reference such as "password_command", or "default".
+func (c *Config) Source(f Field) string {
+	if f.Env != "" && os.Getenv(f.Env) != "" {
+		return "env " + f.Env
+	}
+	if c.meta.IsDefined(strings.Split(f.Key, ".")...) {
+		return "file"
+	}
+	for _, ref := range c.secretRefs() {
+		if ref.name != f.Key {
+			continue
+		}
+		section, _, _ := strings.Cut(f.Key, ".")
+		base := strings.TrimPrefix(f.Key, section+".")
+		switch {
+		case ref.file != "":
+			return base + "_file"
+		case ref.command != "":
+			return base + "_command"
+		case ref.credential != "":
+			return base + "_credential"
+		}
+	}
+	if f.IsZero() && f.value.Kind() != reflect.Bool {
+		return "unset"
+	}
+	return "default"
+}
+
+func tomlName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("toml"), ",")
+	if name == "" {
+		return strings.ToLower(sf.Name)
+	}
+	return name
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// secretCommandTimeout bounds how long a *_command secret source may run.
+const secretCommandTimeout = 10 * time.Second
+
+// secretRef describes where a secret may come from besides its literal
+// config value.
+type secretRef struct {
+	name       string // config key of the literal value, for error messages
+	value      *string
+	file       string
+	command    string
+	credential string
+}
+
+func (c *Config) secretRefs() []secretRef {
+	return []secretRef{
+		{
+			name:       "gateway.password",
+			value:      &c.Gateway.Password,
+			file:       c.Gateway.PasswordFile,
+			command:    c.Gateway.PasswordCommand,
+			credential: c.Gateway.PasswordCredential,
+		},
+		{
+			name:       "server.webhook_secret",
+			value:      &c.Server.WebhookSecret,
+			file:       c.Server.WebhookSecretFile,
+			command:    c.Server.WebhookSecretCommand,
+			credential: c.Server.WebhookSecretCredential,
+		},
+	}
+}
+
+// checkSecretRefs rejects configs that give more than one source for the
+// same secret.
+func (c *Config) checkSecretRefs() error {
+	for _, ref := range c.secretRefs() {
+		n := 0
+		for _, v := range []string{*ref.value, ref.file, ref.command, ref.credential} {
+			if v != "" {
+				n++
+			}
+		}
+		if n > 1 {
+			return fmt.Errorf("%s: set only one of the value, _file, _command or _credential", ref.name)
+		}
+	}
+	return nil
+}
+
+// ResolveSecrets fills secrets that have no value (from the file or env)
+// from their external source.
+func (c *Config) ResolveSecrets() error {
+	for _, ref := range c.secretRefs() {
+		if *ref.value != "" {
+			continue
+		}
+		v, err := ref.resolve()
+		if err != nil {
+			return fmt.Errorf("%s: %w", ref.name, err)
+		}
+		*ref.value = v
+	}
+	return nil
+}
+
+func (r secretRef) resolve() (string, error) {
+	switch {
+	case r.file != "":
+		return readSecretFile(expandHome(r.file))
+	case r.command != "":
+		return runSecretCommand(r.command)
+	case r.credential != "":
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return "", fmt.Errorf("credential %q: CREDENTIALS_DIRECTORY is not set (not running under systemd LoadCredential=?)", r.credential)
+		}
+		return readSecretFile(filepath.Join(dir, r.credential))
+	}
+	return "", nil
+}
+
+func readSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading secret file: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// runSecretCommand runs command with sh and returns the first line of its
+// output, matching the convention of password managers such as pass.
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("running %q: %w: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("running %q: %w", command, err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", fmt.Errorf("running %q: no output", command)
+	}
+	return line, nil
+}
@@ -0,0 +1,249 @@
+// Package control implements the local control channel of a running
+// 'pidge serve': a Unix socket and PID file identified by the instance's
+// database path.
+package control
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Commands understood by the control socket.
+const (
+	CmdStatus = "status"
+	CmdStop   = "stop"
+	CmdReload = "reload"
+)
+
+// ErrNotRunning is returned by Call when no server is listening for the
+// instance.
+var ErrNotRunning = errors.New("no running pidge serve for this database")
+
+// errLocked is returned by lockFile when another process holds the lock.
+var errLocked = errors.New("locked by another process")
+
+// Request is sent by a client, one JSON object per connection.
+type Request struct {
+	Command string `json:"command"`
+}
+
+// Response is the server's reply.
+type Response struct {
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Status json.RawMessage `json:"status,omitempty"`
+}
+
+// Handler answers a control request.
+type Handler func(Request) Response
+
+// Paths returns the control socket and PID file paths for the instance using
+// dbPath. They live in $XDG_RUNTIME_DIR/pidge (or a per-user temp directory)
+// and are named by a hash of the absolute DB path, keeping socket paths short.
+// It fails if the directory exists but another user could write to it.
+func Paths(dbPath string) (sock, pid string, err error) {
+	abs, err := filepath.Abs(dbPath)
+	if err != nil {
+		return "", "", fmt.Errorf("resolving db path: %w", err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	name := hex.EncodeToString(sum[:8])
+
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir != "" {
+		dir = filepath.Join(dir, "pidge")
+	} else {
+		dir = filepath.Join(os.TempDir(), "pidge-"+strconv.Itoa(os.Getuid()))
+	}
+	if err := checkDir(dir); err != nil {
+		return "", "", err
+	}
+	return filepath.Join(dir, name+".sock"), filepath.Join(dir, name+".pid"), nil
+}
+
+// checkDir verifies that dir, if it exists, is a directory private to the
+// current user, so nobody else can plant a socket or PID file in it.
+func checkDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking control directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("control directory %s is not a directory", dir)
+	}
+	if err := checkPrivate(info); err != nil {
+		return fmt.Errorf("control directory %s %w", dir, err)
+	}
+	return nil
+}
+
+// Listener is an open control socket and PID file.
+type Listener struct {
+	ln      net.Listener
+	sock    string
+	pidFile string
+	pidLock *os.File
+	wg      sync.WaitGroup
+}
+
+// Listen creates the control socket and PID file for dbPath and serves
+// requests with h until Close. It fails if another server is already
+// listening for the same database.
+func Listen(dbPath string, h Handler) (*Listener, error) {
+	sock, pidFile, err := Paths(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(sock), 0o700); err != nil {
+		return nil, fmt.Errorf("creating control directory: %w", err)
+	}
+	if err := checkDir(filepath.Dir(sock)); err != nil {
+		return nil, err
+	}
+
+	// The PID file stays locked while we run, so 'pidge stop' can tell a
+	// live server from a stale file whose PID has been reused. Taking the
+	// lock first also keeps a second server from removing our socket.
+	pidLock, err := os.OpenFile(pidFile, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening pid file: %w", err)
+	}
+	if err := lockFile(pidLock); err != nil {
+		pidLock.Close()
+		if errors.Is(err, errLocked) {
+			pid, _ := ReadPID(dbPath)
+			return nil, fmt.Errorf("pidge serve is already running for %s (pid %d)", dbPath, pid)
+		}
+		return nil, fmt.Errorf("locking pid file: %w", err)
+	}
+
+	// Where files can't be locked, the socket answering is the only sign of
+	// a running server.
+	if _, err := Call(dbPath, Request{Command: CmdStatus}); err == nil {
+		pidLock.Close()
+		pid, _ := ReadPID(dbPath)
+		return nil, fmt.Errorf("pidge serve is already running for %s (pid %d)", dbPath, pid)
+	}
+	os.Remove(sock) // stale socket from a crashed server
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		pidLock.Close()
+		return nil, fmt.Errorf("listening on control socket: %w", err)
+	}
+	os.Chmod(sock, 0o600)
+
+	if err := pidLock.Truncate(0); err == nil {
+		_, err = pidLock.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	}
+	if err != nil {
+		pidLock.Close()
+		ln.Close()
+		return nil, fmt.Errorf("writing pid file: %w", err)
+	}
+
+	l := &Listener{ln: ln, sock: sock, pidFile: pidFile, pidLock: pidLock}
+	go l.serve(h)
+	return l, nil
+}
+
+func (l *Listener) serve(h Handler) {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("control socket accept", "error", err)
+			continue
+		}
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+			var req Request
+			if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+				json.NewEncoder(conn).Encode(Response{Error: "bad request"})
+				return
+			}
+			json.NewEncoder(conn).Encode(h(req))
+		}()
+	}
+}
+
+// Close stops serving, waits for in-flight requests to be answered and
+// removes the socket and PID file.
+func (l *Listener) Close() error {
+	err := l.ln.Close()
+	l.wg.Wait()
+	os.Remove(l.sock)
+	os.Remove(l.pidFile)
+	l.pidLock.Close()
+	return err
+}
+
+// Call sends a request to the server for dbPath.
+func Call(dbPath string, req Request) (*Response, error) {
+	sock, _, err := Paths(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", sock, 2*time.Second)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("sending control request: %w", err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("reading control response: %w", err)
+	}
+	if !resp.OK {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// ReadPID returns the PID recorded for the server using dbPath.
+func ReadPID(dbPath string) (int, error) {
+	_, pidFile, err := Paths(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// PIDFileHeld reports whether the server that wrote the PID file for dbPath
+// is still running and holding its lock.
+func PIDFileHeld(dbPath string) (bool, error) {
+	_, pidFile, err := Paths(dbPath)
+	if err != nil {
+		return false, err
+	}
+	return isLocked(pidFile)
+}
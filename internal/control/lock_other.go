@@ -0,0 +1,20 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package control
+
+import (
+	"errors"
+	"os"
+)
+
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func isLocked(path string) (bool, error) {
+	return false, errors.ErrUnsupported
+}
+
+func checkPrivate(info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package control
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f without blocking, returning errLocked
+// if another process holds it. It is released when f is closed or the
+// process exits.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errLocked
+	}
+	return err
+}
+
+// isLocked reports whether another process holds the lock on path.
+func isLocked(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("checking pid file lock: %w", err)
+	}
+	return false, nil
+}
+
+// checkPrivate fails unless info is owned by the current user and closed to
+// everyone else.
+func checkPrivate(info os.FileInfo) error {
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		return fmt.Errorf("has mode %#o, want 0700", perm)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("is owned by uid %d, not %d", st.Uid, os.Getuid())
+	}
+	return nil
+}
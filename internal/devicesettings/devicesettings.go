@@ -0,0 +1,246 @@
+// Package devicesettings converts gateway device settings to and from flat
+// "section.key" values, as used by 'pidge settings' and the
+// [gateway.settings] config table.
+package devicesettings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/android-sms-gateway/client-go/smsgateway"
+)
+
+// Values maps "section.key" names, such as "messages.limit_value", to a
+// string, int or bool.
+type Values map[string]any
+
+// Change is a setting whose current value differs from the desired one.
+// From is nil if the gateway doesn't report the setting.
+type Change struct {
+	Key  string `json:"key"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
+}
+
+// secretKeys are write-only settings, masked in diffs and left out of
+// exports.
+var secretKeys = map[string]bool{
+	"encryption.passphrase": true,
+	"webhooks.signing_key":  true,
+	"gateway.private_token": true,
+}
+
+// kinds maps every known key to its value type, read from the json tags of
+// smsgateway.DeviceSettings.
+var kinds = func() map[string]reflect.Kind {
+	m := make(map[string]reflect.Kind)
+	root := reflect.TypeOf(smsgateway.DeviceSettings{})
+	for i := 0; i < root.NumField(); i++ {
+		section := jsonName(root.Field(i))
+		st := root.Field(i).Type.Elem()
+		for j := 0; j < st.NumField(); j++ {
+			m[section+"."+jsonName(st.Field(j))] = st.Field(j).Type.Elem().Kind()
+		}
+	}
+	return m
+}()
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// Keys returns every known setting name, sorted.
+func Keys() []string {
+	keys := make([]string, 0, len(kinds))
+	for k := range kinds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IsSecret reports whether key holds a secret the gateway never returns.
+func IsSecret(key string) bool {
+	return secretKeys[key]
+}
+
+// FromSettings flattens s, leaving out unset settings.
+func FromSettings(s smsgateway.DeviceSettings) (Values, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("encoding settings: %w", err)
+	}
+	var sections map[string]map[string]any
+	if err := json.Unmarshal(b, &sections); err != nil {
+		return nil, fmt.Errorf("decoding settings: %w", err)
+	}
+	return FromSections(sections)
+}
+
+// FromSections flattens a table of sections, such as one decoded from TOML,
+// checking every key and value type.
+func FromSections(sections map[string]map[string]any) (Values, error) {
+	v := make(Values)
+	for section, settings := range sections {
+		for name, value := range settings {
+			if err := v.put(section+"."+name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// Set parses raw as the value of key.
+func (v Values) Set(key, raw string) error {
+	kind, ok := kinds[key]
+	if !ok {
+		return unknownKey(key)
+	}
+	switch kind {
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: expected a whole number", key)
+		}
+		v[key] = n
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: expected true or false", key)
+		}
+		v[key] = b
+	default:
+		v[key] = raw
+	}
+	return nil
+}
+
+// put stores value under key, converting numbers to int.
+func (v Values) put(key string, value any) error {
+	kind, ok := kinds[key]
+	if !ok {
+		return unknownKey(key)
+	}
+	switch kind {
+	case reflect.Int:
+		switch n := value.(type) {
+		case int:
+			v[key] = n
+		case int64:
+			v[key] = int(n)
+		case float64:
+			if n != float64(int(n)) {
+				return fmt.Errorf("%s: expected a whole number", key)
+			}
+			v[key] = int(n)
+		default:
+			return fmt.Errorf("%s: expected a whole number", key)
+		}
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%s: expected true or false", key)
+		}
+		v[key] = b
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string", key)
+		}
+		v[key] = s
+	}
+	return nil
+}
+
+func unknownKey(key string) error {
+	return fmt.Errorf("unknown setting %q (see 'pidge settings keys')", key)
+}
+
+// Sections groups v by section, for writing out as TOML or JSON.
+func (v Values) Sections() map[string]map[string]any {
+	sections := make(map[string]map[string]any)
+	for key, value := range v {
+		section, name, _ := strings.Cut(key, ".")
+		if sections[section] == nil {
+			sections[section] = make(map[string]any)
+		}
+		sections[section][name] = value
+	}
+	return sections
+}
+
+// Settings converts v to gateway settings and validates them.
+func (v Values) Settings() (smsgateway.DeviceSettings, error) {
+	var s smsgateway.DeviceSettings
+	b, err := json.Marshal(v.Sections())
+	if err != nil {
+		return s, fmt.Errorf("encoding settings: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("decoding settings: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// Only returns the values in v for the given keys.
+func (v Values) Only(keys []string) Values {
+	out := make(Values)
+	for _, k := range keys {
+		if value, ok := v[k]; ok {
+			out[k] = value
+		}
+	}
+	return out
+}
+
+// Diff lists the settings in desired that differ from current, sorted by
+// key. Secrets always count as changed, since the gateway doesn't report
+// them.
+func Diff(current, desired Values) []Change {
+	var changes []Change
+	for key, to := range desired {
+		from, ok := current[key]
+		if ok && from == to && !IsSecret(key) {
+			continue
+		}
+		changes = append(changes, Change{Key: key, From: from, To: to})
+	}
+	slices.SortFunc(changes, func(a, b Change) int { return strings.Compare(a.Key, b.Key) })
+	return changes
+}
+
+// ChangedKeys returns the keys of changes.
+func ChangedKeys(changes []Change) []string {
+	keys := make([]string, len(changes))
+	for i, c := range changes {
+		keys[i] = c.Key
+	}
+	return keys
+}
+
+// Format renders a value for display, masking secrets.
+func Format(key string, value any) string {
+	switch {
+	case value == nil:
+		return "(unset)"
+	case IsSecret(key):
+		return "********"
+	}
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
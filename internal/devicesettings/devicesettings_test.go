@@ -0,0 +1,118 @@
+package devicesettings
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/android-sms-gateway/client-go/smsgateway"
+)
+
+// kinds assumes every section of smsgateway.DeviceSettings is a pointer to a
+// struct whose fields are all pointers. Pin that, so a client-go upgrade
+// that changes the shape is caught by the tests.
+func TestDeviceSettingsShape(t *testing.T) {
+	root := reflect.TypeOf(smsgateway.DeviceSettings{})
+	for i := 0; i < root.NumField(); i++ {
+		f := root.Field(i)
+		if f.Type.Kind() != reflect.Pointer || f.Type.Elem().Kind() != reflect.Struct {
+			t.Errorf("DeviceSettings.%s is %s, want a pointer to a struct", f.Name, f.Type)
+			continue
+		}
+		st := f.Type.Elem()
+		for j := 0; j < st.NumField(); j++ {
+			sf := st.Field(j)
+			if sf.Type.Kind() != reflect.Pointer {
+				t.Errorf("%s.%s is %s, want a pointer", st.Name(), sf.Name, sf.Type)
+			}
+			if jsonName(sf) == "" {
+				t.Errorf("%s.%s has no json name", st.Name(), sf.Name)
+			}
+		}
+	}
+	if !slices.Contains(Keys(), "messages.limit_value") {
+		t.Errorf("Keys() = %v, want messages.limit_value among them", Keys())
+	}
+}
+
+func TestPut(t *testing.T) {
+	tests := []struct {
+		key   string
+		value any
+		want  any
+		ok    bool
+	}{
+		{"messages.limit_value", 10, 10, true},
+		{"messages.limit_value", int64(10), 10, true},
+		{"messages.limit_value", float64(10), 10, true},
+		{"messages.limit_value", 10.5, nil, false},
+		{"messages.limit_value", "10", nil, false},
+		{"ping.interval_seconds", float64(-30), -30, true},
+		{"gateway.cloud_url", "https://example.com", "https://example.com", true},
+		{"gateway.cloud_url", 1, nil, false},
+		{"logs.lifetime_days", true, nil, false},
+		{"messages.nonexistent", 1, nil, false},
+	}
+	for _, tt := range tests {
+		v := make(Values)
+		err := v.put(tt.key, tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("put(%q, %#v): err = %v, want ok = %v", tt.key, tt.value, err, tt.ok)
+			continue
+		}
+		if tt.ok && v[tt.key] != tt.want {
+			t.Errorf("put(%q, %#v) stored %#v, want %#v", tt.key, tt.value, v[tt.key], tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	current := Values{
+		"messages.limit_value":  10,
+		"messages.limit_period": "PerHour",
+	}
+	desired := Values{
+		"messages.limit_value":  10,
+		"messages.limit_period": "PerDay",
+		"ping.interval_seconds": 60,
+		"webhooks.signing_key":  "k",
+	}
+	got := ChangedKeys(Diff(current, desired))
+	want := []string{"messages.limit_period", "ping.interval_seconds", "webhooks.signing_key"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Diff = %v, want %v", got, want)
+	}
+
+	// The gateway never reports secrets, so one is always re-sent.
+	current["webhooks.signing_key"] = "k"
+	if got := ChangedKeys(Diff(current, Values{"webhooks.signing_key": "k"})); !slices.Equal(got, []string{"webhooks.signing_key"}) {
+		t.Errorf("Diff of an unchanged secret = %v, want it changed", got)
+	}
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	want := Values{
+		"messages.limit_value":        100,
+		"messages.limit_period":       "PerDay",
+		"messages.sim_selection_mode": "RoundRobin",
+		"ping.interval_seconds":       60,
+		"webhooks.internet_required":  false,
+		"webhooks.retry_count":        3,
+		"gateway.cloud_url":           "https://example.com/api",
+	}
+	s, err := want.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Messages == nil || s.Messages.LimitValue == nil || *s.Messages.LimitValue != 100 {
+		t.Errorf("Settings().Messages = %+v, want limit_value 100", s.Messages)
+	}
+	got, err := FromSettings(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("FromSettings(Settings()) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+// Package e2e implements Android SMS Gateway's end-to-end message encryption:
+// AES-256-CBC with a PBKDF2-SHA1 key derived from a shared passphrase.
+package e2e
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/android-sms-gateway/client-go/smsgateway"
+)
+
+// prefix identifies an encrypted value: $aes-256-cbc/pbkdf2-sha1$i=<iter>$<salt>$<ciphertext>.
+const prefix = "$aes-256-cbc/pbkdf2-sha1$"
+
+// Iterations is the PBKDF2 iteration count used by the gateway app.
+const Iterations = 75000
+
+// ErrWrongPassphrase is returned when a value cannot be decrypted with the
+// configured passphrase.
+var ErrWrongPassphrase = errors.New("cannot decrypt: wrong encryption passphrase")
+
+// IsEncrypted reports whether s looks like a gateway-encrypted value.
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Encrypt encrypts plaintext with the passphrase in the gateway's format.
+func Encrypt(passphrase, plaintext string) (string, error) {
+	salt := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+	key, err := deriveKey(passphrase, salt, Iterations)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("creating cipher: %w", err)
+	}
+
+	data := pad([]byte(plaintext))
+	cipher.NewCBCEncrypter(block, salt).CryptBlocks(data, data)
+
+	return fmt.Sprintf("%si=%d$%s$%s", prefix, Iterations,
+		base64.StdEncoding.EncodeToString(salt),
+		base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt or the gateway app.
+func Decrypt(passphrase, s string) (string, error) {
+	if !IsEncrypted(s) {
+		return "", fmt.Errorf("value is not encrypted")
+	}
+	parts := strings.Split(strings.TrimPrefix(s, prefix), "$")
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "i=") {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	iter, err := strconv.Atoi(strings.TrimPrefix(parts[0], "i="))
+	if err != nil || iter <= 0 {
+		return "", fmt.Errorf("malformed iteration count %q", parts[0])
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(salt) != aes.BlockSize {
+		return "", fmt.Errorf("malformed salt")
+	}
+	data, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", fmt.Errorf("malformed ciphertext")
+	}
+
+	key, err := deriveKey(passphrase, salt, iter)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("creating cipher: %w", err)
+	}
+	cipher.NewCBCDecrypter(block, salt).CryptBlocks(data, data)
+
+	// A wrong key almost always yields invalid padding; the UTF-8 check
+	// catches most of the rest.
+	plain, ok := unpad(data)
+	if !ok || !utf8.Valid(plain) {
+		return "", ErrWrongPassphrase
+	}
+	return string(plain), nil
+}
+
+// DecryptIfEncrypted decrypts s if it is encrypted and returns it unchanged
+// otherwise.
+func DecryptIfEncrypted(passphrase, s string) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+	return Decrypt(passphrase, s)
+}
+
+// EncryptMessage encrypts a message's text and recipients in place and marks
+// it as encrypted.
+func EncryptMessage(passphrase string, msg *smsgateway.Message) error {
+	if msg.TextMessage != nil {
+		text, err := Encrypt(passphrase, msg.TextMessage.Text)
+		if err != nil {
+			return err
+		}
+		msg.TextMessage = &smsgateway.TextMessage{Text: text}
+	}
+	phones := make([]string, len(msg.PhoneNumbers))
+	for i, p := range msg.PhoneNumbers {
+		enc, err := Encrypt(passphrase, p)
+		if err != nil {
+			return err
+		}
+		phones[i] = enc
+	}
+	msg.PhoneNumbers = phones
+	msg.IsEncrypted = true
+	return nil
+}
+
+// DecryptState decrypts the recipient phone numbers of an encrypted message
+// state in place. Values that fail to decrypt are left as they are.
+func DecryptState(passphrase string, state *smsgateway.MessageState) {
+	if !state.IsEncrypted {
+		return
+	}
+	for i, r := range state.Recipients {
+		if p, err := DecryptIfEncrypted(passphrase, r.PhoneNumber); err == nil {
+			state.Recipients[i].PhoneNumber = p
+		}
+	}
+}
+
+func deriveKey(passphrase string, salt []byte, iter int) ([]byte, error) {
+	key, err := pbkdf2.Key(sha1.New, passphrase, salt, iter, 32)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+	return key, nil
+}
+
+func pad(b []byte) []byte {
+	n := aes.BlockSize - len(b)%aes.BlockSize
+	return append(b, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func unpad(b []byte) ([]byte, bool) {
+	n := int(b[len(b)-1])
+	if n == 0 || n > aes.BlockSize || n > len(b) {
+		return nil, false
+	}
+	for _, c := range b[len(b)-n:] {
+		if int(c) != n {
+			return nil, false
+		}
+	}
+	return b[:len(b)-n], true
+}
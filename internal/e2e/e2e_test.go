@@ -0,0 +1,48 @@
+package e2e
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// vector was produced outside Go from the gateway's documented format:
+// key = PBKDF2-SHA1(passphrase, salt, 75000, 32), IV = salt, PKCS#7 padding.
+const (
+	vectorPassphrase = "correct horse battery staple"
+	vectorPlaintext  = "Hello from the gateway 👋"
+	vector           = "$aes-256-cbc/pbkdf2-sha1$i=75000$AAECAwQFBgcICQoLDA0ODw==$otl+9kCdDdd2ZJ172/6CwpxlveON6zpLDy2DQm6SqBo="
+)
+
+func TestDecryptVector(t *testing.T) {
+	got, err := Decrypt(vectorPassphrase, vector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != vectorPlaintext {
+		t.Errorf("Decrypt = %q, want %q", got, vectorPlaintext)
+	}
+
+	if _, err := Decrypt("wrong", vector); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Decrypt with wrong passphrase: err = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, plain := range []string{"", "hi", "exactly 16 bytes", "+15551234567", strings.Repeat("long message ", 40)} {
+		enc, err := Encrypt(vectorPassphrase, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(enc) {
+			t.Fatalf("Encrypt(%q) = %q, missing prefix", plain, enc)
+		}
+		got, err := Decrypt(vectorPassphrase, enc)
+		if err != nil {
+			t.Fatalf("Decrypt(Encrypt(%q)): %v", plain, err)
+		}
+		if got != plain {
+			t.Errorf("round trip = %q, want %q", got, plain)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package healthhistory summarises the gateway health samples recorded by
+// 'pidge serve' into uptime, battery trends and outages.
+package healthhistory
+
+import (
+	"time"
+
+	"github.com/typhonius/pidge/internal/store"
+)
+
+// BatteryCheck is the gateway health check reporting battery percentage.
+const BatteryCheck = "battery:level"
+
+// Summary describes gateway health over a period.
+type Summary struct {
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+	Samples int       `json:"samples"`
+	// Uptime is the percentage of samples in which the gateway was reachable
+	// and not failing.
+	Uptime  float64  `json:"uptime"`
+	Battery *Battery `json:"battery,omitempty"`
+	Outages []Outage `json:"outages"`
+}
+
+// Battery summarises the battery:level check.
+type Battery struct {
+	First int          `json:"first"`
+	Last  int          `json:"last"`
+	Min   int          `json:"min"`
+	Max   int          `json:"max"`
+	Days  []BatteryDay `json:"days"`
+}
+
+// BatteryDay is the battery range seen on one local calendar day.
+type BatteryDay struct {
+	Date    string `json:"date"`
+	Min     int    `json:"min"`
+	Max     int    `json:"max"`
+	Average int    `json:"average"`
+}
+
+// Outage is a run of samples in which the gateway was failing or
+// unreachable.
+type Outage struct {
+	Start time.Time `json:"start"`
+	// End is when the gateway was next seen healthy, or nil if it hasn't
+	// been yet.
+	End *time.Time `json:"end,omitempty"`
+	// Seconds runs to End, or to the end of the summary if ongoing.
+	Seconds int64 `json:"durationSeconds"`
+	// Status is "unreachable" if the gateway couldn't be reached at any
+	// point, otherwise "fail".
+	Status  string `json:"status"`
+	Samples int    `json:"samples"`
+}
+
+// Duration returns how long the outage lasted.
+func (o Outage) Duration() time.Duration {
+	return time.Duration(o.Seconds) * time.Second
+}
+
+// Up reports whether a sample counts towards uptime.
+func Up(h store.HealthSample) bool {
+	return h.Status != "fail" && h.Status != store.HealthUnreachable
+}
+
+// Summarize summarises samples, which must be oldest first, taken between
+// since and until.
+func Summarize(samples []store.HealthSample, since, until time.Time) Summary {
+	s := Summary{Since: since, Until: until, Samples: len(samples), Outages: []Outage{}}
+
+	up := 0
+	var outage *Outage
+	var days []BatteryDay
+	var dayTotal, dayCount int
+	for _, h := range samples {
+		if Up(h) {
+			up++
+			if outage != nil {
+				end := h.SampledAt
+				outage.End = &end
+				outage.Seconds = int64(end.Sub(outage.Start).Seconds())
+				s.Outages = append(s.Outages, *outage)
+				outage = nil
+			}
+		} else {
+			if outage == nil {
+				outage = &Outage{Start: h.SampledAt, Status: h.Status}
+			}
+			outage.Samples++
+			if h.Status == store.HealthUnreachable {
+				outage.Status = store.HealthUnreachable
+			}
+		}
+
+		c, ok := h.Checks[BatteryCheck]
+		if !ok {
+			continue
+		}
+		level := c.Value
+		if s.Battery == nil {
+			s.Battery = &Battery{First: level, Min: level, Max: level}
+		}
+		s.Battery.Last = level
+		s.Battery.Min = min(s.Battery.Min, level)
+		s.Battery.Max = max(s.Battery.Max, level)
+
+		date := h.SampledAt.Local().Format(time.DateOnly)
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			if len(days) > 0 {
+				days[len(days)-1].Average = dayTotal / dayCount
+			}
+			days = append(days, BatteryDay{Date: date, Min: level, Max: level})
+			dayTotal, dayCount = 0, 0
+		}
+		d := &days[len(days)-1]
+		d.Min = min(d.Min, level)
+		d.Max = max(d.Max, level)
+		dayTotal += level
+		dayCount++
+	}
+	if outage != nil {
+		outage.Seconds = int64(until.Sub(outage.Start).Seconds())
+		s.Outages = append(s.Outages, *outage)
+	}
+	if len(days) > 0 {
+		days[len(days)-1].Average = dayTotal / dayCount
+		s.Battery.Days = days
+	}
+	if len(samples) > 0 {
+		s.Uptime = float64(up) * 100 / float64(len(samples))
+	}
+	return s
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -10,14 +11,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/android-sms-gateway/client-go/rest"
 	"github.com/android-sms-gateway/client-go/smsgateway"
+	"github.com/typhonius/pidge/internal/e2e"
+	"github.com/typhonius/pidge/internal/sms"
 	"github.com/typhonius/pidge/internal/store"
 )
 
 func (s *Server) handleListMessages(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	f := store.ListFilter{
-		Phone: q.Get("phone"),
+		Phone:     q.Get("phone"),
+		DeviceID:  q.Get("device"),
+		Ascending: q.Get("order") == "asc",
 	}
 
 	if v := q.Get("since"); v != "" {
@@ -30,6 +36,11 @@ func (s *Server) handleListMessages(w http.ResponseWriter, r *http.Request) {
 			f.Before = &t
 		}
 	}
+	if v := q.Get("sim"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			f.SimNumber = n
+		}
+	}
 	if v := q.Get("processed"); v != "" {
 		b := v == "true" || v == "1"
 		f.Processed = &b
@@ -89,7 +100,7 @@ func (s *Server) handleMarkProcessed(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.store.MarkProcessed(id); err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, store.ErrNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
 			return
 		}
@@ -110,7 +121,7 @@ func (s *Server) handleMarkUnprocessed(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.store.MarkUnprocessed(id); err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, store.ErrNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
 			return
 		}
@@ -135,8 +146,46 @@ func (s *Server) handleMarkAllProcessed(w http.ResponseWriter, r *http.Request)
 
 // sendRequest is the JSON body for POST /api/send.
 type sendRequest struct {
-	PhoneNumber string `json:"phoneNumber"`
-	Message     string `json:"message"`
+	// PhoneNumber is accepted alongside phoneNumbers for older clients.
+	PhoneNumber        string     `json:"phoneNumber"`
+	PhoneNumbers       []string   `json:"phoneNumbers"`
+	Message            string     `json:"message"`
+	SimNumber          int        `json:"simNumber"`
+	TTL                int64      `json:"ttl"` // seconds
+	ValidUntil         *time.Time `json:"validUntil"`
+	Priority           int        `json:"priority"`
+	WithDeliveryReport *bool      `json:"withDeliveryReport"`
+	DeviceID           string     `json:"deviceId"`
+	Transliterate      bool       `json:"transliterate"`
+}
+
+// sendResponse is the gateway's message state plus how the text was split.
+type sendResponse struct {
+	smsgateway.MessageState
+	Segments int          `json:"segments"`
+	Encoding sms.Encoding `json:"encoding"`
+}
+
+func (r sendRequest) options() sms.Options {
+	opts := sms.Options{
+		PhoneNumbers:  r.PhoneNumbers,
+		Text:          r.Message,
+		SimNumber:     r.SimNumber,
+		TTL:           time.Duration(r.TTL) * time.Second,
+		Priority:      r.Priority,
+		DeviceID:      r.DeviceID,
+		Transliterate: r.Transliterate,
+	}
+	if r.PhoneNumber != "" {
+		opts.PhoneNumbers = append([]string{r.PhoneNumber}, opts.PhoneNumbers...)
+	}
+	if r.ValidUntil != nil {
+		opts.ValidUntil = *r.ValidUntil
+	}
+	if r.WithDeliveryReport != nil {
+		opts.NoDeliveryReport = !*r.WithDeliveryReport
+	}
+	return opts
 }
 
 func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
@@ -146,25 +195,81 @@ func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.PhoneNumber == "" || req.Message == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "phoneNumber and message are required"})
+	opts := req.options()
+	opts.MaxSegments = s.options().MaxSegments
+	msg, err := opts.Message()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	state, err := s.client.Send(ctx, smsgateway.Message{
-		TextMessage:  &smsgateway.TextMessage{Text: req.Message},
-		PhoneNumbers: []string{req.PhoneNumber},
-	})
+	to := strings.Join(msg.PhoneNumbers, ",")
+	passphrase := s.options().EncryptionPassphrase
+	if passphrase != "" {
+		if err := e2e.EncryptMessage(passphrase, &msg); err != nil {
+			slog.Error("encrypting SMS", "error", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "encryption error"})
+			return
+		}
+	}
+
+	state, err := s.client.Send(ctx, msg)
 	if err != nil {
-		slog.Error("sending SMS", "error", err, "to", req.PhoneNumber)
+		slog.Error("sending SMS", "error", err, "to", to)
+		writeGatewayError(w, err)
+		return
+	}
+
+	e2e.DecryptState(passphrase, &state)
+
+	analysis := opts.Analyze()
+	slog.Info("SMS sent", "id", state.ID, "to", to, "segments", len(analysis.Segments))
+	writeJSON(w, http.StatusOK, sendResponse{
+		MessageState: state,
+		Segments:     len(analysis.Segments),
+		Encoding:     analysis.Encoding,
+	})
+}
+
+// writeGatewayError maps an error from the gateway client to a response:
+// not found and rejected requests keep their meaning, anything else is a 502.
+func writeGatewayError(w http.ResponseWriter, err error) {
+	switch {
+	case isGatewayNotFound(err):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	case rest.IsBadRequest(err):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("gateway rejected request: %v", err)})
+	default:
 		writeJSON(w, http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("gateway error: %v", err)})
+	}
+}
+
+// isGatewayNotFound reports whether the gateway answered 404. The client
+// library has no error value for it, only its generic client error with the
+// status code in the message.
+func isGatewayNotFound(err error) bool {
+	return rest.IsClientError(err) && strings.Contains(err.Error(), "status code 404")
+}
+
+func (s *Server) handleMessageState(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	state, err := s.client.GetState(ctx, id)
+	if err != nil {
+		if !isGatewayNotFound(err) {
+			slog.Error("getting message state", "error", err, "id", id)
+		}
+		writeGatewayError(w, err)
 		return
 	}
 
-	slog.Info("SMS sent", "id", state.ID, "to", req.PhoneNumber)
+	e2e.DecryptState(s.options().EncryptionPassphrase, &state)
 	writeJSON(w, http.StatusOK, state)
 }
 
@@ -182,6 +287,21 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		result["store"] = stats
 	}
 
+	// Webhook verification rejections since startup
+	result["webhooks"] = map[string]int64{
+		"rejected_signature": s.rejected.signature.Load(),
+		"rejected_stale":     s.rejected.stale.Load(),
+		"rejected_replay":    s.rejected.replay.Load(),
+	}
+
+	// Device settings drift from [gateway.settings]
+	if check := s.settings.Load(); check != nil {
+		result["settings"] = check
+		if check.Status == settingsDrift || check.Status == settingsError {
+			result["status"] = "degraded"
+		}
+	}
+
 	// Gateway health
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
@@ -193,12 +313,50 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		result["gateway"] = map[string]any{
 			"status":  health.Status,
 			"version": health.Version,
+			"checks":  health.Checks,
 		}
 	}
 
 	writeJSON(w, http.StatusOK, result)
 }
 
+// handleHealthz is a liveness probe: it succeeds whenever the server is
+// answering requests.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz is a readiness probe: it fails with 503 unless the store can
+// be queried and the gateway reports itself healthy.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"store": "ok", "gateway": "ok"}
+	ready := true
+
+	if _, err := s.store.Stats(); err != nil {
+		checks["store"] = err.Error()
+		ready = false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	health, err := s.client.CheckHealth(ctx)
+	switch {
+	case err != nil:
+		checks["gateway"] = "unreachable: " + err.Error()
+		ready = false
+	case health.Status == smsgateway.HealthStatusFail:
+		checks["gateway"] = "status " + string(health.Status)
+		ready = false
+	}
+
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "not_ready", "checks": checks})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ready", "checks": checks})
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
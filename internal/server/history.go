@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/typhonius/pidge/internal/healthhistory"
+	"github.com/typhonius/pidge/internal/store"
+)
+
+// defaultHistoryPeriod is how far back /api/health/history looks without
+// ?since.
+const defaultHistoryPeriod = 7 * 24 * time.Hour
+
+// SampleHealth records the gateway's health every interval until stop is
+// closed, deleting samples older than retention.
+func (s *Server) SampleHealth(stop <-chan struct{}, interval, retention time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		sample := s.sampleHealth(ctx)
+		cancel()
+
+		if err := s.store.SaveHealthSample(sample); err != nil {
+			slog.Warn("saving health sample failed", "error", err)
+		}
+		if n, err := s.store.PruneHealthSamples(time.Now().Add(-retention)); err != nil {
+			slog.Warn("pruning health samples failed", "error", err)
+		} else if n > 0 {
+			slog.Debug("health samples pruned", "count", n)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *Server) sampleHealth(ctx context.Context) store.HealthSample {
+	sample := store.HealthSample{SampledAt: time.Now()}
+	health, err := s.client.CheckHealth(ctx)
+	if err != nil {
+		sample.Status = store.HealthUnreachable
+		sample.Error = err.Error()
+		return sample
+	}
+	sample.Status = string(health.Status)
+	sample.Version = health.Version
+	sample.Checks = make(map[string]store.HealthCheck, len(health.Checks))
+	for name, c := range health.Checks {
+		sample.Checks[name] = store.HealthCheck{Status: string(c.Status), Value: c.ObservedValue, Unit: c.ObservedUnit}
+	}
+	return sample
+}
+
+func (s *Server) handleHealthHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	until := time.Now()
+	if v := q.Get("until"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			until = t
+		}
+	}
+	since := until.Add(-defaultHistoryPeriod)
+	if v := q.Get("since"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			since = t
+		}
+	}
+
+	samples, err := s.store.ListHealthSamples(since, until)
+	if err != nil {
+		slog.Error("listing health samples", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if samples == nil {
+		samples = []store.HealthSample{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"summary": healthhistory.Summarize(samples, since, until),
+		"samples": samples,
+	})
+}
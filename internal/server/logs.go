@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/typhonius/pidge/internal/store"
+)
+
+// logArchiveBackfill is how far back the first archive run looks.
+const logArchiveBackfill = 30 * 24 * time.Hour
+
+// ArchiveLogs copies the gateway's device logs into the store every interval
+// until stop is closed, deleting archived entries older than retention if it
+// is non-zero.
+func (s *Server) ArchiveLogs(stop <-chan struct{}, interval, retention time.Duration) {
+	for {
+		added, pruned, err := s.archiveLogs(retention)
+		if err != nil {
+			slog.Warn("archiving device logs failed", "error", err)
+		} else {
+			slog.Debug("device logs archived", "added", added, "pruned", pruned)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// archiveLogs copies device logs newer than the latest archived entry into
+// the store and prunes entries older than retention.
+func (s *Server) archiveLogs(retention time.Duration) (added int, pruned int64, err error) {
+	now := time.Now()
+	from, err := s.store.LatestDeviceLog()
+	if err != nil {
+		return 0, 0, err
+	}
+	if from.IsZero() {
+		from = now.Add(-logArchiveBackfill)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	entries, err := s.client.GetLogs(ctx, from, now)
+	if err != nil {
+		return 0, 0, fmt.Errorf("fetching logs: %w", err)
+	}
+	logs := make([]store.DeviceLog, len(entries))
+	for i, e := range entries {
+		logs[i] = store.DeviceLog{
+			LogID:     e.ID,
+			Priority:  string(e.Priority),
+			Module:    e.Module,
+			Message:   e.Message,
+			Context:   e.Context,
+			CreatedAt: e.CreatedAt,
+		}
+	}
+	if added, err = s.store.SaveDeviceLogs(logs); err != nil {
+		return 0, 0, err
+	}
+
+	if retention > 0 {
+		if pruned, err = s.store.PruneDeviceLogs(now.Add(-retention)); err != nil {
+			return added, 0, err
+		}
+	}
+	return added, pruned, nil
+}
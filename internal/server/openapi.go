@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+//go:embed docs.html
+var docsTemplate string
+
+// docsPage is the embedded OpenAPI document rendered as HTML on first use.
+// The page is self-contained and loads no external scripts.
+var docsPage = sync.OnceValues(renderDocs)
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
+
+func (s *Server) handleDocs(w http.ResponseWriter, r *http.Request) {
+	page, err := docsPage()
+	if err != nil {
+		slog.Error("rendering API docs failed", "error", err)
+		http.Error(w, "rendering API docs failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(page)
+}
+
+// openAPIDoc is the subset of an OpenAPI 3 document that the docs page shows.
+type openAPIDoc struct {
+	Info struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Version     string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Parameters    map[string]openAPIParameter `json:"parameters"`
+		RequestBodies map[string]openAPIBody      `json:"requestBodies"`
+		Responses     map[string]openAPIBody      `json:"responses"`
+		Schemas       map[string]json.RawMessage  `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description"`
+	Parameters  []openAPIParameter     `json:"parameters"`
+	RequestBody *openAPIBody           `json:"requestBody"`
+	Responses   map[string]openAPIBody `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Ref         string `json:"$ref"`
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+// openAPIBody is a request body or a response.
+type openAPIBody struct {
+	Ref         string `json:"$ref"`
+	Description string `json:"description"`
+	Content     map[string]struct {
+		Schema json.RawMessage `json:"schema"`
+	} `json:"content"`
+}
+
+type docsOperation struct {
+	ID          string
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Parameters  []openAPIParameter
+	RequestBody *docsSchema
+	Responses   []docsResponse
+}
+
+type docsResponse struct {
+	Status      string
+	Description string
+	Schema      *docsSchema
+}
+
+// docsSchema is a body's schema: a named component schema (optionally an
+// array of it) or an inline schema shown as JSON.
+type docsSchema struct {
+	Ref    string
+	Array  bool
+	Inline string
+}
+
+type docsNamedSchema struct {
+	Name string
+	JSON string
+}
+
+// methodOrder is the order operations on the same path are listed in.
+var methodOrder = []string{"get", "post", "put", "patch", "delete"}
+
+func renderDocs() ([]byte, error) {
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		return nil, fmt.Errorf("parsing openapi.json: %w", err)
+	}
+
+	var ops []docsOperation
+	for p, methods := range doc.Paths {
+		for method, op := range methods {
+			ops = append(ops, docsOperation{
+				ID:          op.OperationID,
+				Method:      strings.ToUpper(method),
+				Path:        p,
+				Summary:     op.Summary,
+				Description: op.Description,
+				Parameters:  doc.parameters(op.Parameters),
+				RequestBody: doc.requestBody(op.RequestBody),
+				Responses:   doc.responses(op.Responses),
+			})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return slices.Index(methodOrder, strings.ToLower(ops[i].Method)) <
+			slices.Index(methodOrder, strings.ToLower(ops[j].Method))
+	})
+
+	var schemas []docsNamedSchema
+	for name, raw := range doc.Components.Schemas {
+		schemas = append(schemas, docsNamedSchema{Name: name, JSON: indentJSON(raw)})
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Name < schemas[j].Name })
+
+	tmpl, err := template.New("docs").Parse(docsTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parsing docs.html: %w", err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, map[string]any{
+		"Title":       doc.Info.Title,
+		"Description": doc.Info.Description,
+		"Version":     doc.Info.Version,
+		"Operations":  ops,
+		"Schemas":     schemas,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rendering docs.html: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *openAPIDoc) parameters(params []openAPIParameter) []openAPIParameter {
+	out := make([]openAPIParameter, 0, len(params))
+	for _, p := range params {
+		if p.Ref != "" {
+			p = d.Components.Parameters[path.Base(p.Ref)]
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func (d *openAPIDoc) requestBody(body *openAPIBody) *docsSchema {
+	if body == nil {
+		return nil
+	}
+	b := *body
+	if b.Ref != "" {
+		b = d.Components.RequestBodies[path.Base(b.Ref)]
+	}
+	return bodySchema(b)
+}
+
+func (d *openAPIDoc) responses(responses map[string]openAPIBody) []docsResponse {
+	var out []docsResponse
+	for status, r := range responses {
+		if r.Ref != "" {
+			r = d.Components.Responses[path.Base(r.Ref)]
+		}
+		out = append(out, docsResponse{Status: status, Description: r.Description, Schema: bodySchema(r)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Status < out[j].Status })
+	return out
+}
+
+// bodySchema returns the schema of b's first content type, or nil if it has
+// none.
+func bodySchema(b openAPIBody) *docsSchema {
+	types := make([]string, 0, len(b.Content))
+	for t := range b.Content {
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	sort.Strings(types)
+	raw := b.Content[types[0]].Schema
+
+	var ref struct {
+		Ref   string `json:"$ref"`
+		Type  string `json:"type"`
+		Items struct {
+			Ref string `json:"$ref"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(raw, &ref); err == nil {
+		switch {
+		case ref.Ref != "":
+			return &docsSchema{Ref: path.Base(ref.Ref)}
+		case ref.Type == "array" && ref.Items.Ref != "":
+			return &docsSchema{Ref: path.Base(ref.Items.Ref), Array: true}
+		}
+	}
+	return &docsSchema{Inline: indentJSON(raw)}
+}
+
+func indentJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// checkSpec verifies that every registered route has a matching operation in
+// the embedded OpenAPI document, so a route cannot ship undocumented.
+func checkSpec(routes []route) error {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return fmt.Errorf("parsing openapi.json: %w", err)
+	}
+
+	var missing []string
+	for _, rt := range routes {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		path = strings.TrimSuffix(path, "{$}")
+		if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+			missing = append(missing, rt.pattern)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("routes missing from openapi.json: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	s := New(nil, nil, Options{})
+	if err := checkSpec(s.routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDocsPage(t *testing.T) {
+	page, err := renderDocs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(page)
+	if strings.Contains(html, "<script") {
+		t.Error("docs page loads a script, want it self-contained")
+	}
+	for _, rt := range New(nil, nil, Options{}).routes() {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		path = strings.TrimSuffix(path, "{$}")
+		if !strings.Contains(html, `<span class="method">`+method+`</span> `+path+`</h3>`) {
+			t.Errorf("docs page is missing %s", rt.pattern)
+		}
+	}
+	for _, want := range []string{`array of <a href="#schema-ReceivedMessage">`, `<h3 id="schema-SendRequest">`, "X-Signature"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("docs page is missing %q", want)
+		}
+	}
+}
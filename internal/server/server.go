@@ -2,48 +2,152 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/android-sms-gateway/client-go/smsgateway"
+	"github.com/typhonius/pidge/internal/devicesettings"
 	"github.com/typhonius/pidge/internal/store"
+	"github.com/typhonius/pidge/internal/systemd"
 )
 
+// WebhookSecret is an HMAC-SHA256 key accepted for webhook verification.
+type WebhookSecret struct {
+	Secret string
+	// Expires is when the secret stops being accepted. Zero means never.
+	Expires time.Time
+}
+
+// Options configures a Server.
+type Options struct {
+	// WebhookSecrets are the HMAC-SHA256 keys used to verify webhooks; a
+	// request signed with any unexpired one is accepted. Empty disables
+	// verification.
+	WebhookSecrets []WebhookSecret
+	// WebhookTolerance is the maximum allowed skew between X-Timestamp and
+	// the server clock. Signatures are remembered for this long to reject
+	// replays.
+	WebhookTolerance time.Duration
+	// EncryptionPassphrase is the gateway's end-to-end encryption
+	// passphrase. When set, outgoing messages are encrypted and encrypted
+	// webhook payloads are decrypted before storing.
+	EncryptionPassphrase string
+	// MaxSegments rejects sends that would split into more SMS than this.
+	// Zero means no limit.
+	MaxSegments int
+	// DesiredSettings are the device settings the gateway should have. Nil
+	// disables settings checks.
+	DesiredSettings devicesettings.Values
+	// EnforceSettings re-applies DesiredSettings when the device drifts
+	// from them.
+	EnforceSettings bool
+}
+
 // Server is the pidge HTTP server handling webhooks and the REST API.
 type Server struct {
-	store         *store.Store
-	client        *smsgateway.Client
-	webhookSecret string
-	httpServer    *http.Server
+	store      *store.Store
+	client     *smsgateway.Client
+	opts       atomic.Pointer[Options]
+	certs      *certReloader
+	httpServer *http.Server
+
+	rejected webhookRejections
+	settings atomic.Pointer[SettingsCheck]
+}
+
+// webhookRejections counts webhooks refused by verification, reported by
+// /api/health.
+type webhookRejections struct {
+	signature atomic.Int64
+	stale     atomic.Int64
+	replay    atomic.Int64
 }
 
 // New creates a new Server.
-func New(st *store.Store, client *smsgateway.Client, webhookSecret string) *Server {
-	return &Server{
-		store:         st,
-		client:        client,
-		webhookSecret: webhookSecret,
+func New(st *store.Store, client *smsgateway.Client, opts Options) *Server {
+	s := &Server{
+		store:  st,
+		client: client,
+	}
+	s.opts.Store(&opts)
+	return s
+}
+
+// Reload replaces the server's options. In-flight requests finish with the
+// options they started with.
+func (s *Server) Reload(opts Options) {
+	s.opts.Store(&opts)
+}
+
+// ReloadTLS switches to a new certificate and key. It is a no-op when the
+// server is not serving TLS.
+func (s *Server) ReloadTLS(certFile, keyFile string) error {
+	if s.certs == nil {
+		return nil
+	}
+	return s.certs.SetPaths(certFile, keyFile)
+}
+
+func (s *Server) options() *Options {
+	return s.opts.Load()
+}
+
+// route pairs a ServeMux pattern with its handler.
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// routes returns every endpoint served by pidge. Each one must be documented
+// in openapi.json; TestSpecCoversRoutes fails otherwise.
+func (s *Server) routes() []route {
+	return []route{
+		// Webhook endpoints (gateway POSTs here)
+		{"POST /{$}", s.handleWebhook},
+		{"POST /webhook", s.handleWebhook},
+
+		// REST API
+		{"GET /api/messages", s.handleListMessages},
+		{"GET /api/messages/{id}", s.handleGetMessage},
+		{"POST /api/messages/{id}/processed", s.handleMarkProcessed},
+		{"DELETE /api/messages/{id}/processed", s.handleMarkUnprocessed},
+		{"POST /api/messages/processed", s.handleMarkAllProcessed},
+		{"POST /api/send", s.handleSend},
+		{"GET /api/send/{id}", s.handleMessageState},
+		{"GET /api/health", s.handleHealth},
+		{"GET /api/health/history", s.handleHealthHistory},
+		{"GET /healthz", s.handleHealthz},
+		{"GET /readyz", s.handleReadyz},
+
+		// API documentation
+		{"GET /api/openapi.json", s.handleOpenAPI},
+		{"GET /api/docs", s.handleDocs},
 	}
 }
 
 // Start begins listening on the given address. If certFile and keyFile are
-// non-empty, it serves HTTPS; otherwise plain HTTP.
+// non-empty, it serves HTTPS; otherwise plain HTTP. When started by systemd
+// socket activation the inherited socket is used and addr is ignored.
 func (s *Server) Start(addr, certFile, keyFile string) error {
-	mux := http.NewServeMux()
-
-	// Webhook endpoints (gateway POSTs here)
-	mux.HandleFunc("POST /{$}", s.handleWebhook)
-	mux.HandleFunc("POST /webhook", s.handleWebhook)
+	ln, err := s.Listen(addr, certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
 
-	// REST API
-	mux.HandleFunc("GET /api/messages", s.handleListMessages)
-	mux.HandleFunc("GET /api/messages/{id}", s.handleGetMessage)
-	mux.HandleFunc("POST /api/messages/{id}/processed", s.handleMarkProcessed)
-	mux.HandleFunc("DELETE /api/messages/{id}/processed", s.handleMarkUnprocessed)
-	mux.HandleFunc("POST /api/messages/processed", s.handleMarkAllProcessed)
-	mux.HandleFunc("POST /api/send", s.handleSend)
-	mux.HandleFunc("GET /api/health", s.handleHealth)
+// Listen prepares the server and opens its listener without accepting
+// connections yet, so callers can report readiness once it returns.
+func (s *Server) Listen(addr, certFile, keyFile string) (net.Listener, error) {
+	mux := http.NewServeMux()
+	for _, rt := range s.routes() {
+		mux.HandleFunc(rt.pattern, rt.handler)
+	}
 
 	s.httpServer = &http.Server{
 		Addr:         addr,
@@ -54,16 +158,42 @@ func (s *Server) Start(addr, certFile, keyFile string) error {
 	}
 
 	if certFile != "" && keyFile != "" {
-		slog.Info("server starting (TLS)", "addr", addr)
-		err := s.httpServer.ListenAndServeTLS(certFile, keyFile)
-		if err == http.ErrServerClosed {
-			return nil
+		certs, err := newCertReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
 		}
-		return err
+		s.certs = certs
+		s.httpServer.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
 	}
 
-	slog.Info("server starting", "addr", addr)
-	err := s.httpServer.ListenAndServe()
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	switch len(activated) {
+	case 0:
+		return net.Listen("tcp", addr)
+	case 1:
+		slog.Info("using socket from systemd", "addr", activated[0].Addr())
+		return activated[0], nil
+	default:
+		for _, ln := range activated {
+			ln.Close()
+		}
+		return nil, fmt.Errorf("systemd passed %d sockets; expected 1", len(activated))
+	}
+}
+
+// Serve accepts connections on ln, which must come from Listen.
+func (s *Server) Serve(ln net.Listener) error {
+	var err error
+	if s.certs != nil {
+		slog.Info("server starting (TLS)", "addr", ln.Addr())
+		err = s.httpServer.ServeTLS(ln, "", "")
+	} else {
+		slog.Info("server starting", "addr", ln.Addr())
+		err = s.httpServer.Serve(ln)
+	}
 	if err == http.ErrServerClosed {
 		return nil
 	}
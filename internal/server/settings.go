@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/typhonius/pidge/internal/devicesettings"
+)
+
+// Settings check results reported by /api/health.
+const (
+	settingsInSync    = "in_sync"
+	settingsDrift     = "drift"
+	settingsCorrected = "corrected"
+	settingsError     = "error"
+)
+
+// SettingsCheck is the result of the last comparison of the device's settings
+// with the desired ones.
+type SettingsCheck struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// Drift lists the settings that differed. With status "corrected" they
+	// have since been re-applied.
+	Drift []devicesettings.Change `json:"drift,omitempty"`
+	Error string                  `json:"error,omitempty"`
+}
+
+// CheckSettings compares the device's settings with Options.DesiredSettings,
+// logging any drift and re-applying the desired values if
+// Options.EnforceSettings is set. It does nothing if no settings are
+// desired.
+func (s *Server) CheckSettings(ctx context.Context) *SettingsCheck {
+	opts := s.options()
+	if len(opts.DesiredSettings) == 0 {
+		s.settings.Store(nil)
+		return nil
+	}
+
+	check := &SettingsCheck{Status: settingsInSync, CheckedAt: time.Now()}
+	defer s.settings.Store(check)
+
+	fail := func(msg string, err error) *SettingsCheck {
+		slog.Warn(msg, "error", err)
+		check.Status = settingsError
+		check.Error = err.Error()
+		return check
+	}
+
+	settings, err := s.client.GetSettings(ctx)
+	if err != nil {
+		return fail("checking device settings failed", err)
+	}
+	current, err := devicesettings.FromSettings(settings)
+	if err != nil {
+		return fail("checking device settings failed", err)
+	}
+
+	// The gateway never returns secrets, so they can't be checked.
+	desired := make(devicesettings.Values)
+	for key, value := range opts.DesiredSettings {
+		if !devicesettings.IsSecret(key) {
+			desired[key] = value
+		}
+	}
+	check.Drift = devicesettings.Diff(current, desired)
+	if len(check.Drift) == 0 {
+		slog.Debug("device settings in sync")
+		return check
+	}
+
+	check.Status = settingsDrift
+	// Only warn about drift that's new since the last check.
+	log := slog.Warn
+	if prev := s.settings.Load(); prev != nil && prev.Status == settingsDrift && fmt.Sprint(prev.Drift) == fmt.Sprint(check.Drift) {
+		log = slog.Debug
+	}
+	for _, c := range check.Drift {
+		log("device setting drifted", "key", c.Key, "value", c.From, "want", c.To)
+	}
+	if !opts.EnforceSettings {
+		return check
+	}
+
+	patch, err := desired.Only(devicesettings.ChangedKeys(check.Drift)).Settings()
+	if err != nil {
+		return fail("re-applying device settings failed", err)
+	}
+	if _, err := s.client.UpdateSettings(ctx, patch); err != nil {
+		check.Error = err.Error()
+		slog.Warn("re-applying device settings failed", "error", err)
+		return check
+	}
+	check.Status = settingsCorrected
+	slog.Info("device settings re-applied", "changed", len(check.Drift))
+	return check
+}
+
+// WatchSettings runs CheckSettings every interval until stop is closed.
+func (s *Server) WatchSettings(stop <-chan struct{}, interval time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		s.CheckSettings(ctx)
+		cancel()
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
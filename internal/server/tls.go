@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval limits how often the certificate files are stat'd.
+const certCheckInterval = 30 * time.Second
+
+// certReloader serves a TLS certificate from disk, reloading it when the cert
+// or key file changes (e.g. after 'tailscale cert' renews it).
+type certReloader struct {
+	mu        sync.Mutex
+	certFile  string
+	keyFile   string
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetPaths switches to a different cert/key pair, loading it immediately.
+func (r *certReloader) SetPaths(certFile, keyFile string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if certFile == r.certFile && keyFile == r.keyFile {
+		return nil
+	}
+	oldCert, oldKey := r.certFile, r.keyFile
+	r.certFile, r.keyFile = certFile, keyFile
+	if err := r.loadLocked(); err != nil {
+		r.certFile, r.keyFile = oldCert, oldKey
+		return err
+	}
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) >= certCheckInterval {
+		r.lastCheck = time.Now()
+		if mt := r.latestModTime(); mt.After(r.modTime) {
+			if err := r.loadLocked(); err != nil {
+				// Keep serving the old certificate until the new pair is
+				// readable; the files may be mid-rename.
+				slog.Error("reloading TLS certificate", "error", err)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.loadLocked()
+}
+
+func (r *certReloader) loadLocked() error {
+	mt := r.latestModTime()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	if r.cert != nil {
+		slog.Info("TLS certificate reloaded", "cert", r.certFile, "expires", cert.Leaf.NotAfter)
+	}
+	r.cert = &cert
+	r.modTime = mt
+	r.lastCheck = time.Now()
+	return nil
+}
+
+func (r *certReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		if fi, err := os.Stat(f); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
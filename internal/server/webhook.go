@@ -5,12 +5,15 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/typhonius/pidge/internal/e2e"
 	"github.com/typhonius/pidge/internal/store"
 )
 
@@ -30,6 +33,8 @@ type webhookPayload struct {
 }
 
 func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	handled := false
+
 	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20)) // 1 MB max
 	if err != nil {
 		slog.Error("reading webhook body", "error", err)
@@ -37,12 +42,25 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if s.webhookSecret != "" {
-		if !s.verifySignature(body, r.Header.Get("X-Signature"), r.Header.Get("X-Timestamp")) {
+	if len(s.options().WebhookSecrets) > 0 {
+		signature, timestamp := r.Header.Get("X-Signature"), r.Header.Get("X-Timestamp")
+		if !s.verifySignature(body, signature, timestamp) {
+			s.rejected.signature.Add(1)
 			slog.Warn("webhook signature verification failed")
 			http.Error(w, "invalid signature", http.StatusUnauthorized)
 			return
 		}
+		if !s.checkFreshness(signature, timestamp) {
+			http.Error(w, "stale or replayed request", http.StatusUnauthorized)
+			return
+		}
+		// Only a handled request uses up its signature; on any error the
+		// gateway's retry must not be rejected as a replay.
+		defer func() {
+			if !handled {
+				s.forgetNonce(signature)
+			}
+		}()
 	}
 
 	var payload webhookPayload
@@ -54,6 +72,7 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 
 	if payload.Event != "sms:received" {
 		slog.Debug("ignoring non-sms event", "event", payload.Event)
+		handled = true
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, `{"status":"ignored","event":%q}`, payload.Event)
 		return
@@ -65,6 +84,12 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.decryptPayload(&payload); err != nil {
+		slog.Error("decrypting webhook payload", "error", err, "event_id", payload.ID)
+		http.Error(w, "decryption failed", http.StatusInternalServerError)
+		return
+	}
+
 	receivedAt, err := time.Parse(time.RFC3339, payload.Payload.ReceivedAt)
 	if err != nil {
 		// Try alternate format
@@ -101,23 +126,112 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		"preview", truncate(payload.Payload.Message, 40),
 	)
 
+	handled = true
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"status":"stored","eventId":%q}`, payload.ID)
 }
 
+// verifySignature reports whether signature matches the body under any
+// unexpired webhook secret.
 func (s *Server) verifySignature(body []byte, signature, timestamp string) bool {
 	if signature == "" || timestamp == "" {
 		return false
 	}
 
-	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
-	mac.Write([]byte(timestamp))
-	mac.Write([]byte("."))
-	mac.Write(body)
-	expected := hex.EncodeToString(mac.Sum(nil))
+	now := time.Now()
+	for _, secret := range s.options().WebhookSecrets {
+		if !secret.Expires.IsZero() && now.After(secret.Expires) {
+			continue
+		}
+		mac := hmac.New(sha256.New, []byte(secret.Secret))
+		mac.Write([]byte(timestamp))
+		mac.Write([]byte("."))
+		mac.Write(body)
+		expected := hex.EncodeToString(mac.Sum(nil))
+
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptPayload decrypts the message and phone number of an encrypted
+// sms:received payload in place. Plaintext fields are left untouched.
+func (s *Server) decryptPayload(p *webhookPayload) error {
+	passphrase := s.options().EncryptionPassphrase
+	fields := []*string{&p.Payload.Message, &p.Payload.PhoneNumber}
+	for _, f := range fields {
+		if !e2e.IsEncrypted(*f) {
+			continue
+		}
+		if passphrase == "" {
+			return fmt.Errorf("payload is encrypted but encryption_passphrase is not set")
+		}
+		plain, err := e2e.Decrypt(passphrase, *f)
+		if err != nil {
+			if errors.Is(err, e2e.ErrWrongPassphrase) {
+				return fmt.Errorf("%w (check encryption_passphrase matches the gateway app)", err)
+			}
+			return err
+		}
+		*f = plain
+	}
+	return nil
+}
+
+// checkFreshness rejects webhooks whose X-Timestamp falls outside the
+// tolerance window, and signatures already seen within it.
+func (s *Server) checkFreshness(signature, timestamp string) bool {
+	tolerance := s.options().WebhookTolerance
+	if tolerance <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		s.rejected.stale.Add(1)
+		slog.Warn("webhook rejected: unparseable timestamp", "timestamp", timestamp)
+		return false
+	}
+	skew := now.Sub(time.Unix(ts, 0))
+	if skew < -tolerance || skew > tolerance {
+		s.rejected.stale.Add(1)
+		slog.Warn("webhook rejected: timestamp outside tolerance",
+			"timestamp", ts, "skew", skew.Round(time.Second), "tolerance", tolerance)
+		return false
+	}
+
+	fresh, err := s.store.RecordNonce(signature, now)
+	if err != nil {
+		// Fail open: the timestamp check still bounds the replay window.
+		slog.Error("recording webhook nonce", "error", err)
+		return true
+	}
+	if !fresh {
+		s.rejected.replay.Add(1)
+		slog.Warn("webhook rejected: replayed signature", "timestamp", ts)
+		return false
+	}
+
+	// Anything older than twice the window can no longer pass the timestamp
+	// check, so it is safe to forget.
+	if _, err := s.store.PruneNonces(now.Add(-2 * tolerance)); err != nil {
+		slog.Error("pruning webhook nonces", "error", err)
+	}
+	return true
+}
 
-	return hmac.Equal([]byte(expected), []byte(signature))
+// forgetNonce releases a signature recorded by checkFreshness.
+func (s *Server) forgetNonce(signature string) {
+	if s.options().WebhookTolerance <= 0 {
+		return
+	}
+	if err := s.store.ForgetNonce(signature); err != nil {
+		slog.Error("forgetting webhook nonce", "error", err)
+	}
 }
 
 func truncate(s string, n int) string {
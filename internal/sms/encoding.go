@@ -0,0 +1,158 @@
+package sms
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Encoding is the character set a message is sent in.
+type Encoding string
+
+const (
+	// GSM7 packs 160 characters into a single SMS.
+	GSM7 Encoding = "GSM-7"
+	// UCS2 is used when any character is outside GSM-7, cutting a single
+	// SMS to 70 characters.
+	UCS2 Encoding = "UCS-2"
+)
+
+// Units per SMS. Multipart messages lose room to the concatenation header.
+const (
+	gsm7Single = 160
+	gsm7Multi  = 153
+	ucs2Single = 70
+	ucs2Multi  = 67
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet, less the escape character.
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension characters take two septets: an escape and the character.
+const gsm7Extension = "\f^{}\\[~]|€"
+
+// Segment is one SMS of a message.
+type Segment struct {
+	Text string `json:"text"`
+	// Units is the segment's length in septets (GSM-7) or UTF-16 code
+	// units (UCS-2).
+	Units int `json:"units"`
+}
+
+// Analysis describes how a message will be encoded and split.
+type Analysis struct {
+	Encoding Encoding `json:"encoding"`
+	// Characters is the number of characters in the message.
+	Characters int `json:"characters"`
+	// Units is the total length in septets or UTF-16 code units.
+	Units int `json:"units"`
+	// PerSegment is how many units fit in each segment.
+	PerSegment int       `json:"perSegment"`
+	Segments   []Segment `json:"segments"`
+	// NonGSM lists the characters that force UCS-2, in order of appearance.
+	NonGSM []string `json:"nonGsm,omitempty"`
+}
+
+// gsm7Units returns the septets r takes in GSM-7, or 0 if it can't be
+// encoded.
+func gsm7Units(r rune) int {
+	switch {
+	case strings.ContainsRune(gsm7Basic, r):
+		return 1
+	case strings.ContainsRune(gsm7Extension, r):
+		return 2
+	}
+	return 0
+}
+
+// Analyze works out the encoding and segments the gateway's phone will use
+// to send text.
+func Analyze(text string) Analysis {
+	a := Analysis{Encoding: GSM7}
+	seen := make(map[rune]bool)
+	for _, r := range text {
+		a.Characters++
+		if gsm7Units(r) == 0 {
+			a.Encoding = UCS2
+			if !seen[r] {
+				seen[r] = true
+				a.NonGSM = append(a.NonGSM, string(r))
+			}
+		}
+	}
+
+	units := func(r rune) int {
+		if a.Encoding == GSM7 {
+			return gsm7Units(r)
+		}
+		return utf16.RuneLen(r)
+	}
+	for _, r := range text {
+		a.Units += units(r)
+	}
+
+	single, multi := gsm7Single, gsm7Multi
+	if a.Encoding == UCS2 {
+		single, multi = ucs2Single, ucs2Multi
+	}
+	a.PerSegment = single
+	if a.Units > single {
+		a.PerSegment = multi
+	}
+
+	// Split without breaking escape sequences or surrogate pairs.
+	var cur strings.Builder
+	n := 0
+	for _, r := range text {
+		u := units(r)
+		if n+u > a.PerSegment {
+			a.Segments = append(a.Segments, Segment{Text: cur.String(), Units: n})
+			cur.Reset()
+			n = 0
+		}
+		cur.WriteRune(r)
+		n += u
+	}
+	if n > 0 || len(a.Segments) == 0 {
+		a.Segments = append(a.Segments, Segment{Text: cur.String(), Units: n})
+	}
+	return a
+}
+
+// transliterations replace common characters outside GSM-7 with close
+// GSM-7 equivalents.
+var transliterations = strings.NewReplacer(
+	// Punctuation
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`, "«", `"`, "»", `"`,
+	"–", "-", "—", "-", "‐", "-", "‑", "-", "−", "-",
+	"…", "...", "•", "*", "·", "*",
+	"\u00a0", " ", "\u2009", " ", "\u200b", "", "\t", " ",
+	// Latin letters with accents GSM-7 lacks
+	"á", "a", "â", "a", "ã", "a", "ā", "a", "ą", "a",
+	"Á", "A", "Â", "A", "Ã", "A", "À", "A", "Ā", "A", "Ą", "A",
+	"ç", "c", "ć", "c", "č", "c", "Ć", "C", "Č", "C",
+	"ê", "e", "ë", "e", "ē", "e", "ę", "e", "ě", "e",
+	"È", "E", "Ê", "E", "Ë", "E", "Ē", "E", "Ę", "E", "Ě", "E",
+	"í", "i", "î", "i", "ï", "i", "ī", "i",
+	"Í", "I", "Ì", "I", "Î", "I", "Ï", "I", "Ī", "I",
+	"ł", "l", "Ł", "L",
+	"ń", "n", "ň", "n", "Ń", "N", "Ň", "N",
+	"ó", "o", "ô", "o", "õ", "o", "ō", "o", "ő", "o",
+	"Ó", "O", "Ò", "O", "Ô", "O", "Õ", "O", "Ō", "O", "Ő", "O",
+	"ř", "r", "Ř", "R",
+	"ś", "s", "š", "s", "ș", "s", "ş", "s", "Ś", "S", "Š", "S", "Ș", "S", "Ş", "S",
+	"ț", "t", "ţ", "t", "Ț", "T", "Ţ", "T",
+	"ú", "u", "û", "u", "ū", "u", "ů", "u", "ű", "u",
+	"Ú", "U", "Ù", "U", "Û", "U", "Ū", "U", "Ů", "U", "Ű", "U",
+	"ý", "y", "ÿ", "y", "Ý", "Y",
+	"ź", "z", "ż", "z", "ž", "z", "Ź", "Z", "Ż", "Z", "Ž", "Z",
+	"œ", "oe", "Œ", "OE",
+)
+
+// Transliterate replaces smart quotes, dashes and accented letters that
+// aren't in GSM-7 with plain equivalents, so a message isn't sent as UCS-2
+// just because of them. Other characters, such as emoji, are left alone.
+func Transliterate(text string) string {
+	return transliterations.Replace(text)
+}
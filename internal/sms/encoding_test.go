@@ -0,0 +1,78 @@
+package sms
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		encoding Encoding
+		units    []int
+		nonGSM   []string
+	}{
+		{"empty", "", GSM7, []int{0}, nil},
+		{"GSM-7 single", strings.Repeat("a", 160), GSM7, []int{160}, nil},
+		{"GSM-7 multipart", strings.Repeat("a", 161), GSM7, []int{153, 8}, nil},
+		{"UCS-2 single", strings.Repeat("ж", 70), UCS2, []int{70}, []string{"ж"}},
+		{"UCS-2 multipart", strings.Repeat("ж", 71), UCS2, []int{67, 4}, []string{"ж"}},
+		{
+			"escape kept whole at boundary",
+			strings.Repeat("a", 152) + "€" + strings.Repeat("b", 8),
+			GSM7, []int{152, 10}, nil,
+		},
+		{
+			"surrogate pair kept whole at boundary",
+			strings.Repeat("ж", 66) + "😀" + strings.Repeat("ж", 4),
+			UCS2, []int{66, 6}, []string{"ж", "😀"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Analyze(tt.text)
+			if a.Encoding != tt.encoding {
+				t.Errorf("Encoding = %s, want %s", a.Encoding, tt.encoding)
+			}
+			var units []int
+			var joined strings.Builder
+			for _, s := range a.Segments {
+				units = append(units, s.Units)
+				joined.WriteString(s.Text)
+			}
+			if !slices.Equal(units, tt.units) {
+				t.Errorf("segment units = %v, want %v", units, tt.units)
+			}
+			if joined.String() != tt.text {
+				t.Error("segments don't join back into the message")
+			}
+			if !slices.Equal(a.NonGSM, tt.nonGSM) {
+				t.Errorf("NonGSM = %q, want %q", a.NonGSM, tt.nonGSM)
+			}
+		})
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		text     string
+		want     string
+		encoding Encoding
+	}{
+		{"“Quoted” – it’s naïve…", `"Quoted" - it's naive...`, GSM7},
+		{"Łódź, Świętokrzyska", "Lodz, Swietokrzyska", GSM7},
+		{"café", "café", GSM7},
+		{"ok 👍", "ok 👍", UCS2},
+	}
+	for _, tt := range tests {
+		got := Transliterate(tt.text)
+		if got != tt.want {
+			t.Errorf("Transliterate(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if enc := Analyze(got).Encoding; enc != tt.encoding {
+			t.Errorf("Transliterate(%q) is sent as %s, want %s", tt.text, enc, tt.encoding)
+		}
+	}
+}
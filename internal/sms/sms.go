@@ -0,0 +1,134 @@
+// Package sms builds outgoing gateway messages from the send options pidge
+// accepts on the command line and over the REST API.
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/android-sms-gateway/client-go/smsgateway"
+)
+
+// ErrInvalid is wrapped by every validation error from Options.Message.
+var ErrInvalid = errors.New("invalid message")
+
+// Gateway limits on message fields.
+const (
+	MaxRecipients = 100
+	MaxSIM        = 3
+	MinTTL        = 5 * time.Second
+	maxDeviceID   = 21
+)
+
+// Options describes a text message to send.
+type Options struct {
+	PhoneNumbers []string
+	Text         string
+	// SimNumber selects the SIM (1-3). Zero uses the device default.
+	SimNumber int
+	// TTL and ValidUntil bound how long the gateway keeps trying to send.
+	// At most one may be set.
+	TTL        time.Duration
+	ValidUntil time.Time
+	// Priority ranges from -128 to 127; 100 and above bypass the device's
+	// send limits and delays.
+	Priority         int
+	NoDeliveryReport bool
+	// DeviceID sends from a specific device instead of letting the gateway
+	// choose.
+	DeviceID string
+	// Transliterate replaces characters that would force UCS-2 with GSM-7
+	// equivalents where possible.
+	Transliterate bool
+	// MaxSegments rejects messages that would be split into more SMS than
+	// this. Zero means no limit.
+	MaxSegments int
+}
+
+// text returns the message text as it will be sent.
+func (o Options) text() string {
+	if o.Transliterate {
+		return Transliterate(o.Text)
+	}
+	return o.Text
+}
+
+// Analyze reports how the message text will be encoded and split.
+func (o Options) Analyze() Analysis {
+	return Analyze(o.text())
+}
+
+// SplitRecipients splits a comma-separated list of phone numbers.
+func SplitRecipients(s string) []string {
+	var numbers []string
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// Message validates o and returns the gateway message for it.
+func (o Options) Message() (smsgateway.Message, error) {
+	invalid := func(format string, args ...any) (smsgateway.Message, error) {
+		return smsgateway.Message{}, fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case len(o.PhoneNumbers) == 0:
+		return invalid("at least one phone number is required")
+	case len(o.PhoneNumbers) > MaxRecipients:
+		return invalid("at most %d recipients are allowed, got %d", MaxRecipients, len(o.PhoneNumbers))
+	case o.Text == "":
+		return invalid("message text is required")
+	case o.SimNumber < 0 || o.SimNumber > MaxSIM:
+		return invalid("SIM number must be between 1 and %d", MaxSIM)
+	case o.TTL != 0 && !o.ValidUntil.IsZero():
+		return invalid("TTL and valid-until cannot both be set")
+	case o.TTL != 0 && o.TTL < MinTTL:
+		return invalid("TTL must be at least %s", MinTTL)
+	case !o.ValidUntil.IsZero() && !o.ValidUntil.After(time.Now()):
+		return invalid("valid-until %s is in the past", o.ValidUntil.Format(time.RFC3339))
+	case o.Priority < int(smsgateway.PriorityMinimum) || o.Priority > int(smsgateway.PriorityMaximum):
+		return invalid("priority must be between %d and %d", smsgateway.PriorityMinimum, smsgateway.PriorityMaximum)
+	case len(o.DeviceID) > maxDeviceID:
+		return invalid("device ID is too long")
+	}
+	for _, n := range o.PhoneNumbers {
+		if strings.TrimSpace(n) == "" {
+			return invalid("phone numbers must not be empty")
+		}
+	}
+	if o.MaxSegments > 0 {
+		if a := o.Analyze(); len(a.Segments) > o.MaxSegments {
+			return invalid("message is %d %s segments, more than the limit of %d", len(a.Segments), a.Encoding, o.MaxSegments)
+		}
+	}
+
+	msg := smsgateway.Message{
+		DeviceID:     o.DeviceID,
+		TextMessage:  &smsgateway.TextMessage{Text: o.text()},
+		PhoneNumbers: o.PhoneNumbers,
+		Priority:     smsgateway.MessagePriority(o.Priority),
+	}
+	if o.SimNumber > 0 {
+		sim := uint8(o.SimNumber)
+		msg.SimNumber = &sim
+	}
+	if o.TTL > 0 {
+		ttl := uint64(o.TTL / time.Second)
+		msg.TTL = &ttl
+	}
+	if !o.ValidUntil.IsZero() {
+		until := o.ValidUntil.UTC()
+		msg.ValidUntil = &until
+	}
+	if o.NoDeliveryReport {
+		report := false
+		msg.WithDeliveryReport = &report
+	}
+	return msg, nil
+}
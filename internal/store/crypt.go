@@ -0,0 +1,281 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Encrypted column values are stored as encPrefix + base64(nonce || ciphertext).
+const encPrefix = "enc:v1:"
+
+// KeySize is the length in bytes of database encryption keys.
+const KeySize = 32
+
+// ErrWrongKey is returned by Open when the supplied key cannot unwrap the
+// database's data key.
+var ErrWrongKey = errors.New("wrong database encryption key")
+
+// ErrKeyRequired is returned by Open when the database is encrypted but no
+// key was supplied.
+var ErrKeyRequired = errors.New("database is encrypted; configure db_key_file or PIDGE_DB_KEY")
+
+// GenerateKey returns a new random key, hex encoded.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generating key: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// ParseKey decodes a hex or base64 encoded key.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := hex.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key must be %d bytes, hex or base64 encoded", KeySize)
+}
+
+// cryptor encrypts column values with a subkey of the database's data key
+// (DEK), and computes blind indexes with a second one. The DEK is random per
+// database and stored in the meta table wrapped by the user-supplied key
+// (KEK), so rekeying only rewraps the DEK.
+type cryptor struct {
+	dek      []byte
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+func newCryptor(dek []byte) (*cryptor, error) {
+	encKey, err := hkdf.Key(sha256.New, dek, nil, "enc", KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("deriving encryption key: %w", err)
+	}
+	indexKey, err := hkdf.Key(sha256.New, dek, nil, "index", KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("deriving index key: %w", err)
+	}
+	aead, err := newGCM(encKey)
+	if err != nil {
+		return nil, err
+	}
+	return &cryptor{dek: dek, aead: aead, indexKey: indexKey}, nil
+}
+
+func (c *cryptor) encrypt(plain string) (string, error) {
+	sealed, err := seal(c.aead, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	return encPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns plaintext values unchanged, so databases part-way through
+// 'pidge db encrypt' stay readable.
+func (c *cryptor) decrypt(v string) (string, error) {
+	if !strings.HasPrefix(v, encPrefix) {
+		return v, nil
+	}
+	if c == nil {
+		return "", ErrKeyRequired
+	}
+	sealed, err := base64.StdEncoding.DecodeString(v[len(encPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("decoding encrypted value: %w", err)
+	}
+	plain, err := open(c.aead, sealed)
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// blindIndex returns a keyed hash of the given parts, used in place of the
+// plaintext for exact-match lookups and deduplication.
+func (c *cryptor) blindIndex(parts ...string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte("pidge-index"))
+	for _, p := range parts {
+		mac.Write([]byte{0})
+		mac.Write([]byte(p))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *cryptor) phoneHash(phone string) string {
+	return c.blindIndex("phone", phone)
+}
+
+func (c *cryptor) dedupHash(phone, message string, receivedAt time.Time) string {
+	return c.blindIndex("dedup", phone, message, receivedAt.UTC().Format(time.RFC3339Nano))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], nil)
+}
+
+// loadDEK unwraps the database's data key with kek. It returns nil if the
+// database has no data key yet, and fails if it has one but kek is nil.
+func loadDEK(db *sql.DB, kek []byte) (*cryptor, error) {
+	wrapped, err := getMeta(db, "dek")
+	if err != nil {
+		return nil, err
+	}
+	if wrapped == "" {
+		return nil, nil
+	}
+	if kek == nil {
+		return nil, ErrKeyRequired
+	}
+
+	kekAEAD, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("decoding data key: %w", err)
+	}
+	dek, err := open(kekAEAD, raw)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return newCryptor(dek)
+}
+
+// createDEK generates a data key for a database that has none and stores it
+// wrapped by kek.
+func createDEK(db *sql.DB, kek []byte) (*cryptor, error) {
+	kekAEAD, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("generating data key: %w", err)
+	}
+	if err := storeDEK(db, kekAEAD, dek); err != nil {
+		return nil, err
+	}
+	return newCryptor(dek)
+}
+
+func storeDEK(db *sql.DB, kekAEAD cipher.AEAD, dek []byte) error {
+	sealed, err := seal(kekAEAD, dek)
+	if err != nil {
+		return err
+	}
+	return setMeta(db, "dek", base64.StdEncoding.EncodeToString(sealed))
+}
+
+// Encrypted reports whether the store encrypts message bodies and phone numbers.
+func (s *Store) Encrypted() bool {
+	return s.crypt != nil
+}
+
+// EncryptExisting encrypts any rows still stored in plaintext and returns how
+// many were updated. The store must have been opened with a key.
+func (s *Store) EncryptExisting() (int, error) {
+	if s.crypt == nil {
+		return 0, fmt.Errorf("store was opened without an encryption key")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, phone_number, message, received_at
+		FROM received_messages WHERE phone_hash IS NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("listing plaintext messages: %w", err)
+	}
+	type plainRow struct {
+		id                 int64
+		phone, message, at string
+	}
+	var pending []plainRow
+	for rows.Next() {
+		var r plainRow
+		if err := rows.Scan(&r.id, &r.phone, &r.message, &r.at); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scanning message: %w", err)
+		}
+		pending = append(pending, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range pending {
+		phone, err := s.crypt.encrypt(r.phone)
+		if err != nil {
+			return 0, err
+		}
+		message, err := s.crypt.encrypt(r.message)
+		if err != nil {
+			return 0, err
+		}
+		dedup := s.crypt.dedupHash(r.phone, r.message, parseTime(r.at))
+		if _, err := tx.Exec(`UPDATE received_messages
+			SET phone_number = ?, message = ?, phone_hash = ?, dedup_hash = ?
+			WHERE id = ?`,
+			phone, message, s.crypt.phoneHash(r.phone), dedup, r.id); err != nil {
+			return 0, fmt.Errorf("encrypting message %d: %w", r.id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing: %w", err)
+	}
+	return len(pending), nil
+}
+
+// Rekey rewraps the data key with newKey. Message rows are not rewritten.
+func (s *Store) Rekey(newKey []byte) error {
+	if s.crypt == nil {
+		return fmt.Errorf("store was opened without an encryption key")
+	}
+	kekAEAD, err := newGCM(newKey)
+	if err != nil {
+		return err
+	}
+	return storeDEK(s.db, kekAEAD, s.crypt.dek)
+}
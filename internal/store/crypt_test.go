@@ -0,0 +1,127 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testMessage(eventID, phone, body string) ReceivedMessage {
+	return ReceivedMessage{
+		EventID:     eventID,
+		MessageID:   "m-" + eventID,
+		PhoneNumber: phone,
+		Message:     body,
+		SimNumber:   1,
+		ReceivedAt:  time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func mustOpen(t *testing.T, path string, key []byte) *Store {
+	t.Helper()
+	st, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// checkMessages asserts that the messages from phone decrypt to bodies.
+func checkMessages(t *testing.T, st *Store, phone string, bodies ...string) {
+	t.Helper()
+	msgs, err := st.ListMessages(ListFilter{Phone: phone, Ascending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != len(bodies) {
+		t.Fatalf("got %d messages from %s, want %d", len(msgs), phone, len(bodies))
+	}
+	for i, m := range msgs {
+		if m.PhoneNumber != phone || m.Message != bodies[i] {
+			t.Errorf("message %d = %q from %q, want %q from %q", i, m.Message, m.PhoneNumber, bodies[i], phone)
+		}
+	}
+}
+
+func TestEncryptRekeyRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pidge.db")
+	const phone = "+15551234567"
+
+	st := mustOpen(t, path, nil)
+	if err := st.SaveMessage(testMessage("e1", phone, "stored in plaintext")); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	oldKey := testKey(t)
+	st = mustOpen(t, path, oldKey)
+	n, err := st.EncryptExisting()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("EncryptExisting = %d, want 1", n)
+	}
+	if err := st.SaveMessage(testMessage("e2", phone, "stored encrypted")); err != nil {
+		t.Fatal(err)
+	}
+	var raw string
+	if err := st.db.QueryRow("SELECT message FROM received_messages WHERE event_id = 'e1'").Scan(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, encPrefix) {
+		t.Errorf("stored message = %q, want it encrypted", raw)
+	}
+
+	newKey := testKey(t)
+	if err := st.Rekey(newKey); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	if _, err := Open(path, oldKey); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open with old key: err = %v, want ErrWrongKey", err)
+	}
+	if _, err := Open(path, nil); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Open without key: err = %v, want ErrKeyRequired", err)
+	}
+
+	st = mustOpen(t, path, newKey)
+	defer st.Close()
+	checkMessages(t, st, phone, "stored in plaintext", "stored encrypted")
+}
+
+func TestOpenReadOnlyCreatesNoKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pidge.db")
+	mustOpen(t, path, nil).Close()
+
+	st, err := OpenReadOnly(path, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Encrypted() {
+		t.Error("read-only store is encrypted, want no data key")
+	}
+	st.Close()
+
+	st = mustOpen(t, path, nil)
+	defer st.Close()
+	if wrapped, err := getMeta(st.db, "dek"); err != nil || wrapped != "" {
+		t.Errorf("data key after OpenReadOnly = %q, %v; want none", wrapped, err)
+	}
+}
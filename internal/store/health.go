@@ -0,0 +1,96 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// HealthUnreachable is the status of a sample taken when the gateway could
+// not be reached.
+const HealthUnreachable = "unreachable"
+
+// HealthSample is one recorded gateway health check.
+type HealthSample struct {
+	SampledAt time.Time `json:"sampledAt"`
+	// Status is the gateway's "pass", "warn" or "fail", or "unreachable".
+	Status  string                 `json:"status"`
+	Version string                 `json:"version,omitempty"`
+	Checks  map[string]HealthCheck `json:"checks,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// HealthCheck is one of the checks in a HealthSample, such as battery:level.
+type HealthCheck struct {
+	Status string `json:"status"`
+	Value  int    `json:"value"`
+	Unit   string `json:"unit,omitempty"`
+}
+
+// SaveHealthSample records a health sample.
+func (s *Store) SaveHealthSample(h HealthSample) error {
+	var checks string
+	if len(h.Checks) > 0 {
+		b, err := json.Marshal(h.Checks)
+		if err != nil {
+			return fmt.Errorf("encoding health checks: %w", err)
+		}
+		checks = string(b)
+	}
+	_, err := s.db.Exec(`INSERT INTO health_samples (sampled_at, status, version, checks, error)
+		VALUES (?, ?, ?, ?, ?)`,
+		h.SampledAt.UTC(), h.Status, h.Version, checks, h.Error)
+	if err != nil {
+		return fmt.Errorf("saving health sample: %w", err)
+	}
+	return nil
+}
+
+// ListHealthSamples returns samples taken in [since, until), oldest first. A
+// zero time leaves that end open.
+func (s *Store) ListHealthSamples(since, until time.Time) ([]HealthSample, error) {
+	query := "SELECT sampled_at, status, version, checks, error FROM health_samples WHERE 1=1"
+	var args []any
+	if !since.IsZero() {
+		query += " AND sampled_at >= ?"
+		args = append(args, since.UTC())
+	}
+	if !until.IsZero() {
+		query += " AND sampled_at < ?"
+		args = append(args, until.UTC())
+	}
+	query += " ORDER BY sampled_at"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing health samples: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []HealthSample
+	for rows.Next() {
+		var h HealthSample
+		var sampledAt, checks string
+		if err := rows.Scan(&sampledAt, &h.Status, &h.Version, &checks, &h.Error); err != nil {
+			return nil, fmt.Errorf("scanning health sample: %w", err)
+		}
+		h.SampledAt = parseTime(sampledAt)
+		if checks != "" {
+			if err := json.Unmarshal([]byte(checks), &h.Checks); err != nil {
+				return nil, fmt.Errorf("health sample at %s: decoding checks: %w", sampledAt, err)
+			}
+		}
+		samples = append(samples, h)
+	}
+	return samples, rows.Err()
+}
+
+// PruneHealthSamples deletes samples taken before the given time.
+func (s *Store) PruneHealthSamples(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM health_samples WHERE sampled_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("pruning health samples: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
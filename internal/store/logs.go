@@ -0,0 +1,134 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DeviceLog is a gateway device log entry kept in the archive.
+type DeviceLog struct {
+	LogID     uint64            `json:"id"`
+	Priority  string            `json:"priority"`
+	Module    string            `json:"module"`
+	Message   string            `json:"message"`
+	Context   map[string]string `json:"context,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// SaveDeviceLogs archives entries, skipping ones already stored, and returns
+// how many were added. Messages and context are encrypted if the store is.
+func (s *Store) SaveDeviceLogs(entries []DeviceLog) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	added := 0
+	for _, e := range entries {
+		var context string
+		if len(e.Context) > 0 {
+			b, err := json.Marshal(e.Context)
+			if err != nil {
+				return 0, fmt.Errorf("encoding log context: %w", err)
+			}
+			context = string(b)
+		}
+		message := e.Message
+		if s.crypt != nil {
+			if message, err = s.crypt.encrypt(message); err != nil {
+				return 0, fmt.Errorf("saving device log: %w", err)
+			}
+			if context != "" {
+				if context, err = s.crypt.encrypt(context); err != nil {
+					return 0, fmt.Errorf("saving device log: %w", err)
+				}
+			}
+		}
+
+		res, err := tx.Exec(`
+			INSERT OR IGNORE INTO device_logs (log_id, priority, module, message, context, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			e.LogID, e.Priority, e.Module, message, context, e.CreatedAt.UTC())
+		if err != nil {
+			return 0, fmt.Errorf("saving device log: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		added += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing: %w", err)
+	}
+	return added, nil
+}
+
+// ListDeviceLogs returns archived entries created in [since, until), oldest
+// first. A zero time leaves that end open.
+func (s *Store) ListDeviceLogs(since, until time.Time) ([]DeviceLog, error) {
+	query := `SELECT log_id, priority, module, message, context, created_at
+		FROM device_logs WHERE 1=1`
+	var args []any
+	if !since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, since.UTC())
+	}
+	if !until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, until.UTC())
+	}
+	query += " ORDER BY created_at, log_id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing device logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []DeviceLog
+	for rows.Next() {
+		var e DeviceLog
+		var context, createdAt string
+		if err := rows.Scan(&e.LogID, &e.Priority, &e.Module, &e.Message, &context, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning device log: %w", err)
+		}
+		if e.Message, err = s.crypt.decrypt(e.Message); err != nil {
+			return nil, fmt.Errorf("device log %d: %w", e.LogID, err)
+		}
+		if context != "" {
+			if context, err = s.crypt.decrypt(context); err != nil {
+				return nil, fmt.Errorf("device log %d: %w", e.LogID, err)
+			}
+			if err := json.Unmarshal([]byte(context), &e.Context); err != nil {
+				return nil, fmt.Errorf("device log %d: decoding context: %w", e.LogID, err)
+			}
+		}
+		e.CreatedAt = parseTime(createdAt)
+		logs = append(logs, e)
+	}
+	return logs, rows.Err()
+}
+
+// LatestDeviceLog returns when the newest archived entry was created, or the
+// zero time if the archive is empty.
+func (s *Store) LatestDeviceLog() (time.Time, error) {
+	var latest *string
+	if err := s.db.QueryRow("SELECT MAX(created_at) FROM device_logs").Scan(&latest); err != nil {
+		return time.Time{}, fmt.Errorf("reading latest device log: %w", err)
+	}
+	if latest == nil {
+		return time.Time{}, nil
+	}
+	return parseTime(*latest), nil
+}
+
+// PruneDeviceLogs deletes archived entries created before the given time.
+func (s *Store) PruneDeviceLogs(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM device_logs WHERE created_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("pruning device logs: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
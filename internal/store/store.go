@@ -1,7 +1,9 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -27,8 +29,57 @@ CREATE UNIQUE INDEX IF NOT EXISTS idx_dedup ON received_messages(phone_number, m
 CREATE INDEX IF NOT EXISTS idx_received_phone ON received_messages(phone_number);
 CREATE INDEX IF NOT EXISTS idx_received_at ON received_messages(received_at);
 CREATE INDEX IF NOT EXISTS idx_processed ON received_messages(processed);
+
+CREATE TABLE IF NOT EXISTS webhook_nonces (
+    nonce   TEXT PRIMARY KEY,
+    seen_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_nonce_seen ON webhook_nonces(seen_at);
+
+CREATE TABLE IF NOT EXISTS meta (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
 `
 
+// migrations upgrade the schema in order; the database's user_version is the
+// number applied so far.
+var migrations = []string{
+	// 1: blind indexes for encrypted phone numbers and deduplication.
+	`ALTER TABLE received_messages ADD COLUMN phone_hash TEXT;
+	 ALTER TABLE received_messages ADD COLUMN dedup_hash TEXT;
+	 CREATE INDEX IF NOT EXISTS idx_phone_hash ON received_messages(phone_hash);
+	 CREATE UNIQUE INDEX IF NOT EXISTS idx_dedup_hash ON received_messages(dedup_hash) WHERE dedup_hash IS NOT NULL;`,
+	// 2: device logs archived from the gateway.
+	`CREATE TABLE IF NOT EXISTS device_logs (
+	     id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	     log_id     INTEGER NOT NULL,
+	     priority   TEXT NOT NULL,
+	     module     TEXT NOT NULL,
+	     message    TEXT NOT NULL,
+	     context    TEXT NOT NULL DEFAULT '',
+	     created_at DATETIME NOT NULL,
+	     UNIQUE (log_id, created_at)
+	 );
+	 CREATE INDEX IF NOT EXISTS idx_device_logs_created ON device_logs(created_at);`,
+	// 3: gateway health samples taken by 'pidge serve'.
+	`CREATE TABLE IF NOT EXISTS health_samples (
+	     id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	     sampled_at DATETIME NOT NULL,
+	     status     TEXT NOT NULL,
+	     version    TEXT NOT NULL DEFAULT '',
+	     checks     TEXT NOT NULL DEFAULT '',
+	     error      TEXT NOT NULL DEFAULT ''
+	 );
+	 CREATE INDEX IF NOT EXISTS idx_health_sampled ON health_samples(sampled_at);`,
+}
+
+// ErrNotFound is returned for a message ID that doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// SchemaVersion is the schema version this build expects.
+var SchemaVersion = len(migrations)
+
 // ReceivedMessage represents a single received SMS stored in the database.
 type ReceivedMessage struct {
 	ID          int64     `json:"id"`
@@ -46,11 +97,15 @@ type ReceivedMessage struct {
 // ListFilter controls which messages are returned by ListMessages.
 type ListFilter struct {
 	Phone     string
+	DeviceID  string
+	SimNumber int
 	Since     *time.Time
 	Before    *time.Time
 	Processed *bool
 	Limit     int
 	Offset    int
+	// Ascending returns the oldest messages first instead of the newest.
+	Ascending bool
 }
 
 // Stats holds summary statistics about the message store.
@@ -62,11 +117,13 @@ type Stats struct {
 
 // Store wraps a SQLite database for received message storage.
 type Store struct {
-	db *sql.DB
+	db    *sql.DB
+	crypt *cryptor
 }
 
 // Open creates or opens the SQLite database at path, creating parent directories as needed.
-func Open(path string) (*Store, error) {
+// If key is non-nil, message bodies and phone numbers are encrypted at rest.
+func Open(path string, key []byte) (*Store, error) {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return nil, fmt.Errorf("creating db directory: %w", err)
@@ -81,8 +138,149 @@ func Open(path string) (*Store, error) {
 		db.Close()
 		return nil, fmt.Errorf("creating schema: %w", err)
 	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	crypt, err := loadDEK(db, key)
+	if err == nil && crypt == nil && key != nil {
+		crypt, err = createDEK(db, key)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	return &Store{db: db}, nil
+	return &Store{db: db, crypt: crypt}, nil
+}
+
+// OpenReadOnly opens an existing database at path without creating,
+// migrating or otherwise writing to it. Its schema must be current.
+func OpenReadOnly(path string, key []byte) (*Store, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("reading schema version: %w", err)
+	}
+	if version != len(migrations) {
+		db.Close()
+		return nil, fmt.Errorf("database schema version %d does not match this pidge (%d)", version, len(migrations))
+	}
+
+	// A database without a data key holds no encrypted values yet, so a
+	// configured key is simply not needed.
+	crypt, err := loadDEK(db, key)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db, crypt: crypt}, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this pidge (%d)", version, len(migrations))
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("beginning migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Version returns the schema version recorded in the database.
+func (s *Store) Version() (int, error) {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// ReadVersion returns the schema version of the database at path without
+// creating or migrating it.
+func ReadVersion(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return 0, fmt.Errorf("opening database: %w", err)
+	}
+	defer db.Close()
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+func getMeta(db *sql.DB, key string) (string, error) {
+	var v string
+	err := db.QueryRow("SELECT value FROM meta WHERE key = ?", key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading meta %s: %w", key, err)
+	}
+	return v, nil
+}
+
+func setMeta(db *sql.DB, key, value string) error {
+	_, err := db.Exec("INSERT INTO meta (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value",
+		key, value)
+	if err != nil {
+		return fmt.Errorf("writing meta %s: %w", key, err)
+	}
+	return nil
+}
+
+// WebhookURL returns the webhook URL 'pidge serve' last registered with the
+// gateway, or "" if none is recorded.
+func (s *Store) WebhookURL() (string, error) {
+	return getMeta(s.db, "webhook_url")
+}
+
+// SetWebhookURL records the webhook URL registered with the gateway.
+func (s *Store) SetWebhookURL(url string) error {
+	return setMeta(s.db, "webhook_url", url)
+}
+
+// Ping checks that the database still answers queries.
+func (s *Store) Ping(ctx context.Context) error {
+	var one int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("pinging database: %w", err)
+	}
+	return nil
 }
 
 // Close closes the database connection.
@@ -92,12 +290,28 @@ func (s *Store) Close() error {
 
 // SaveMessage inserts a received message. Duplicate event_ids are silently ignored.
 func (s *Store) SaveMessage(msg ReceivedMessage) error {
+	phone, message := msg.PhoneNumber, msg.Message
+	var phoneHash, dedupHash *string
+	if s.crypt != nil {
+		var err error
+		if phone, err = s.crypt.encrypt(msg.PhoneNumber); err != nil {
+			return fmt.Errorf("saving message: %w", err)
+		}
+		if message, err = s.crypt.encrypt(msg.Message); err != nil {
+			return fmt.Errorf("saving message: %w", err)
+		}
+		ph := s.crypt.phoneHash(msg.PhoneNumber)
+		dh := s.crypt.dedupHash(msg.PhoneNumber, msg.Message, msg.ReceivedAt)
+		phoneHash, dedupHash = &ph, &dh
+	}
+
 	_, err := s.db.Exec(`
 		INSERT OR IGNORE INTO received_messages
-			(event_id, message_id, device_id, phone_number, message, sim_number, received_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		msg.EventID, msg.MessageID, msg.DeviceID, msg.PhoneNumber,
-		msg.Message, msg.SimNumber, msg.ReceivedAt.UTC(),
+			(event_id, message_id, device_id, phone_number, message, sim_number, received_at,
+			 phone_hash, dedup_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.EventID, msg.MessageID, msg.DeviceID, phone,
+		message, msg.SimNumber, msg.ReceivedAt.UTC(), phoneHash, dedupHash,
 	)
 	if err != nil {
 		return fmt.Errorf("saving message: %w", err)
@@ -111,7 +325,30 @@ func (s *Store) GetMessage(id int64) (*ReceivedMessage, error) {
 		SELECT id, event_id, message_id, device_id, phone_number, message,
 		       sim_number, received_at, created_at, processed
 		FROM received_messages WHERE id = ?`, id)
-	return scanMessage(row)
+	return s.scanMessage(row)
+}
+
+// GetMessageByEventID returns the message stored for a webhook event ID, or
+// nil if there is none.
+func (s *Store) GetMessageByEventID(eventID string) (*ReceivedMessage, error) {
+	row := s.db.QueryRow(`
+		SELECT id, event_id, message_id, device_id, phone_number, message,
+		       sim_number, received_at, created_at, processed
+		FROM received_messages WHERE event_id = ?`, eventID)
+	return s.scanMessage(row)
+}
+
+// DeleteMessage permanently removes a message.
+func (s *Store) DeleteMessage(id int64) error {
+	res, err := s.db.Exec("DELETE FROM received_messages WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting message: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return fmt.Errorf("message %d: %w", id, ErrNotFound)
+	}
+	return nil
 }
 
 // ListMessages returns messages matching the given filter.
@@ -123,8 +360,23 @@ func (s *Store) ListMessages(f ListFilter) ([]ReceivedMessage, error) {
 	var args []any
 
 	if f.Phone != "" {
-		query += " AND phone_number = ?"
-		args = append(args, f.Phone)
+		if s.crypt != nil {
+			// Encrypted rows are matched by blind index; rows not yet
+			// encrypted by 'pidge db encrypt' still match on plaintext.
+			query += " AND (phone_hash = ? OR (phone_hash IS NULL AND phone_number = ?))"
+			args = append(args, s.crypt.phoneHash(f.Phone), f.Phone)
+		} else {
+			query += " AND phone_number = ?"
+			args = append(args, f.Phone)
+		}
+	}
+	if f.DeviceID != "" {
+		query += " AND device_id = ?"
+		args = append(args, f.DeviceID)
+	}
+	if f.SimNumber > 0 {
+		query += " AND sim_number = ?"
+		args = append(args, f.SimNumber)
 	}
 	if f.Since != nil {
 		query += " AND received_at >= ?"
@@ -139,7 +391,11 @@ func (s *Store) ListMessages(f ListFilter) ([]ReceivedMessage, error) {
 		args = append(args, *f.Processed)
 	}
 
-	query += " ORDER BY received_at DESC"
+	if f.Ascending {
+		query += " ORDER BY received_at ASC, id ASC"
+	} else {
+		query += " ORDER BY received_at DESC, id DESC"
+	}
 
 	if f.Limit > 0 {
 		query += " LIMIT ?"
@@ -160,25 +416,11 @@ func (s *Store) ListMessages(f ListFilter) ([]ReceivedMessage, error) {
 
 	var messages []ReceivedMessage
 	for rows.Next() {
-		var m ReceivedMessage
-		var receivedAt, createdAt string
-		if err := rows.Scan(&m.ID, &m.EventID, &m.MessageID, &m.DeviceID,
-			&m.PhoneNumber, &m.Message, &m.SimNumber,
-			&receivedAt, &createdAt, &m.Processed); err != nil {
-			return nil, fmt.Errorf("scanning message: %w", err)
-		}
-		m.ReceivedAt, _ = time.Parse(time.RFC3339, receivedAt)
-		if m.ReceivedAt.IsZero() {
-			m.ReceivedAt, _ = time.Parse("2006-01-02 15:04:05+00:00", receivedAt)
-		}
-		if m.ReceivedAt.IsZero() {
-			m.ReceivedAt, _ = time.Parse("2006-01-02T15:04:05Z", receivedAt)
+		m, err := s.scanMessage(rows)
+		if err != nil {
+			return nil, err
 		}
-		m.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		if m.CreatedAt.IsZero() {
-			m.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-		}
-		messages = append(messages, m)
+		messages = append(messages, *m)
 	}
 	return messages, rows.Err()
 }
@@ -191,7 +433,7 @@ func (s *Store) MarkProcessed(id int64) error {
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return fmt.Errorf("message %d not found", id)
+		return fmt.Errorf("message %d: %w", id, ErrNotFound)
 	}
 	return nil
 }
@@ -214,11 +456,42 @@ func (s *Store) MarkUnprocessed(id int64) error {
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return fmt.Errorf("message %d not found", id)
+		return fmt.Errorf("message %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// RecordNonce remembers a webhook nonce (typically its signature). It returns
+// false if the nonce has already been recorded, meaning the request is a replay.
+func (s *Store) RecordNonce(nonce string, seenAt time.Time) (bool, error) {
+	res, err := s.db.Exec("INSERT OR IGNORE INTO webhook_nonces (nonce, seen_at) VALUES (?, ?)",
+		nonce, seenAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("recording nonce: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// ForgetNonce removes a recorded nonce, so a request that failed after
+// RecordNonce can be retried.
+func (s *Store) ForgetNonce(nonce string) error {
+	if _, err := s.db.Exec("DELETE FROM webhook_nonces WHERE nonce = ?", nonce); err != nil {
+		return fmt.Errorf("forgetting nonce: %w", err)
 	}
 	return nil
 }
 
+// PruneNonces forgets nonces seen before the given time.
+func (s *Store) PruneNonces(before time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM webhook_nonces WHERE seen_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("pruning nonces: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
 // Stats returns summary counts.
 func (s *Store) Stats() (*Stats, error) {
 	var st Stats
@@ -239,7 +512,7 @@ type scanner interface {
 	Scan(dest ...any) error
 }
 
-func scanMessage(row scanner) (*ReceivedMessage, error) {
+func (s *Store) scanMessage(row scanner) (*ReceivedMessage, error) {
 	var m ReceivedMessage
 	var receivedAt, createdAt string
 	if err := row.Scan(&m.ID, &m.EventID, &m.MessageID, &m.DeviceID,
@@ -250,16 +523,31 @@ func scanMessage(row scanner) (*ReceivedMessage, error) {
 		}
 		return nil, fmt.Errorf("scanning message: %w", err)
 	}
-	m.ReceivedAt, _ = time.Parse(time.RFC3339, receivedAt)
-	if m.ReceivedAt.IsZero() {
-		m.ReceivedAt, _ = time.Parse("2006-01-02 15:04:05+00:00", receivedAt)
+	var err error
+	if m.PhoneNumber, err = s.crypt.decrypt(m.PhoneNumber); err != nil {
+		return nil, fmt.Errorf("message %d: %w", m.ID, err)
 	}
-	if m.ReceivedAt.IsZero() {
-		m.ReceivedAt, _ = time.Parse("2006-01-02T15:04:05Z", receivedAt)
-	}
-	m.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-	if m.CreatedAt.IsZero() {
-		m.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	if m.Message, err = s.crypt.decrypt(m.Message); err != nil {
+		return nil, fmt.Errorf("message %d: %w", m.ID, err)
 	}
+	m.ReceivedAt = parseTime(receivedAt)
+	m.CreatedAt = parseTime(createdAt)
 	return &m, nil
 }
+
+// parseTime parses a DATETIME column in any of the formats SQLite and the
+// driver produce.
+func parseTime(v string) time.Time {
+	for _, layout := range []string{
+		time.RFC3339,
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05+00:00",
+		"2006-01-02T15:04:05Z",
+		"2006-01-02 15:04:05",
+	} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
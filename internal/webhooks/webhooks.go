@@ -0,0 +1,169 @@
+// Package webhooks reconciles the gateway's registered webhooks with the
+// events pidge is configured to receive.
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/android-sms-gateway/client-go/smsgateway"
+)
+
+// IDPrefix marks webhooks registered by pidge. Hooks without it were added
+// by hand or by another tool and are never deleted, unless adopted.
+const IDPrefix = "pidge-"
+
+// adoptEvent is the event older pidge versions registered without IDPrefix.
+const adoptEvent = "sms:received"
+
+// Action is one change made (or planned) by Sync.
+type Action struct {
+	Op    string `json:"op"` // "add", "adopt", "delete" or "keep"
+	ID    string `json:"id,omitempty"`
+	URL   string `json:"url"`
+	Event string `json:"event"`
+	// Replaces is the unprefixed hook an "adopt" re-registers.
+	Replaces string `json:"replaces,omitempty"`
+}
+
+// IsOwned reports whether the webhook was registered by pidge.
+func IsOwned(h smsgateway.Webhook) bool {
+	return strings.HasPrefix(h.ID, IDPrefix)
+}
+
+// adoptable reports whether h is an unprefixed sms:received hook for one of
+// urls, as registered by pidge before it used IDPrefix.
+func adoptable(h smsgateway.Webhook, urls []string) bool {
+	return !IsOwned(h) && h.Event == adoptEvent && slices.Contains(urls, h.URL)
+}
+
+// NewID returns a webhook ID marking the hook as owned by pidge.
+func NewID() (string, error) {
+	buf := make([]byte, 15) // 30 hex digits; IDs are limited to 36 chars
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return IDPrefix + hex.EncodeToString(buf), nil
+}
+
+// Plan works out the changes that make hooks match url and events: missing
+// subscriptions are added, and pidge-owned hooks for any other URL or event,
+// or duplicating a wanted one, are deleted. Unprefixed sms:received hooks for
+// url or one of previousURLs are treated as pidge's too, and adopted
+// (re-registered with a pidge ID) when still wanted. Other hooks pidge
+// doesn't own are only ever kept.
+func Plan(hooks []smsgateway.Webhook, url string, events []string, previousURLs ...string) []Action {
+	wanted := make(map[string]bool, len(events))
+	for _, e := range events {
+		wanted[e] = true
+	}
+	adoptURLs := append([]string{url}, previousURLs...)
+
+	// Prefer keeping a hook pidge already owns over adopting one.
+	hooks = slices.Clone(hooks)
+	slices.SortStableFunc(hooks, func(a, b smsgateway.Webhook) int {
+		switch {
+		case IsOwned(a) == IsOwned(b):
+			return 0
+		case IsOwned(a):
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	var actions []Action
+	have := make(map[string]bool)
+	for _, h := range hooks {
+		if h.URL == url && wanted[h.Event] && !have[h.Event] {
+			have[h.Event] = true
+			if adoptable(h, adoptURLs) {
+				actions = append(actions, Action{Op: "adopt", URL: h.URL, Event: h.Event, Replaces: h.ID})
+			} else {
+				actions = append(actions, Action{Op: "keep", ID: h.ID, URL: h.URL, Event: h.Event})
+			}
+			continue
+		}
+		if IsOwned(h) || adoptable(h, adoptURLs) {
+			actions = append(actions, Action{Op: "delete", ID: h.ID, URL: h.URL, Event: h.Event})
+		}
+	}
+	for _, e := range events {
+		if !have[e] {
+			have[e] = true
+			actions = append(actions, Action{Op: "add", URL: url, Event: e})
+		}
+	}
+	return actions
+}
+
+// Sync registers and deletes webhooks so the gateway matches url and events,
+// returning what it did. previousURLs are earlier values of url whose
+// unprefixed hooks may be adopted; see Plan. With dryRun it only returns the
+// plan.
+func Sync(ctx context.Context, client *smsgateway.Client, url string, events []string, previousURLs []string, dryRun bool) ([]Action, error) {
+	hooks, err := client.ListWebhooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing webhooks: %w", err)
+	}
+
+	actions := Plan(hooks, url, events, previousURLs...)
+	if dryRun {
+		return actions, nil
+	}
+
+	// Add before deleting so a URL change never leaves a gap.
+	for i, a := range actions {
+		if a.Op != "add" && a.Op != "adopt" {
+			continue
+		}
+		id, err := NewID()
+		if err != nil {
+			return nil, fmt.Errorf("generating webhook id: %w", err)
+		}
+		hook, err := client.RegisterWebhook(ctx, smsgateway.Webhook{ID: id, URL: a.URL, Event: a.Event})
+		if err != nil {
+			return nil, fmt.Errorf("registering %s webhook: %w", a.Event, err)
+		}
+		actions[i].ID = hook.ID
+	}
+	for _, a := range actions {
+		id := a.ID
+		switch a.Op {
+		case "adopt":
+			id = a.Replaces
+		case "delete":
+		default:
+			continue
+		}
+		if err := client.DeleteWebhook(ctx, id); err != nil {
+			return nil, fmt.Errorf("deleting webhook %s: %w", id, err)
+		}
+	}
+	return actions, nil
+}
+
+// Unregister deletes the pidge-owned webhooks pointing at url, returning
+// their IDs.
+func Unregister(ctx context.Context, client *smsgateway.Client, url string) ([]string, error) {
+	hooks, err := client.ListWebhooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing webhooks: %w", err)
+	}
+
+	var deleted []string
+	for _, h := range hooks {
+		if h.URL != url || !IsOwned(h) {
+			continue
+		}
+		if err := client.DeleteWebhook(ctx, h.ID); err != nil {
+			return deleted, fmt.Errorf("deleting webhook %s: %w", h.ID, err)
+		}
+		deleted = append(deleted, h.ID)
+	}
+	return deleted, nil
+}
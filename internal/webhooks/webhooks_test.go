@@ -0,0 +1,62 @@
+package webhooks
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/android-sms-gateway/client-go/smsgateway"
+)
+
+func TestPlanAdoption(t *testing.T) {
+	const url, old = "https://pidge.example/webhook", "https://old.example/webhook"
+	events := []string{"sms:received"}
+
+	tests := []struct {
+		name     string
+		hooks    []smsgateway.Webhook
+		previous []string
+		want     []Action
+	}{
+		{
+			name:  "adopts unprefixed hook for webhook_url",
+			hooks: []smsgateway.Webhook{{ID: "abc", URL: url, Event: "sms:received"}},
+			want:  []Action{{Op: "adopt", URL: url, Event: "sms:received", Replaces: "abc"}},
+		},
+		{
+			name: "keeps owned hook over unprefixed duplicate",
+			hooks: []smsgateway.Webhook{
+				{ID: "abc", URL: url, Event: "sms:received"},
+				{ID: "pidge-1", URL: url, Event: "sms:received"},
+			},
+			want: []Action{
+				{Op: "keep", ID: "pidge-1", URL: url, Event: "sms:received"},
+				{Op: "delete", ID: "abc", URL: url, Event: "sms:received"},
+			},
+		},
+		{
+			name:     "replaces unprefixed hook for previous url",
+			hooks:    []smsgateway.Webhook{{ID: "abc", URL: old, Event: "sms:received"}},
+			previous: []string{old},
+			want: []Action{
+				{Op: "delete", ID: "abc", URL: old, Event: "sms:received"},
+				{Op: "add", URL: url, Event: "sms:received"},
+			},
+		},
+		{
+			name: "leaves other unprefixed hooks alone",
+			hooks: []smsgateway.Webhook{
+				{ID: "abc", URL: old, Event: "sms:received"},
+				{ID: "def", URL: url, Event: "sms:sent"},
+			},
+			want: []Action{{Op: "add", URL: url, Event: "sms:received"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Plan(tt.hooks, url, events, tt.previous...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan =\n  %+v\nwant\n  %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+// Package pidgeclient is a Go client for the pidge REST API.
+package pidgeclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a pidge server.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client (10s timeout).
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// New creates a Client for the pidge server at baseURL, e.g.
+// "https://host.ts.net:3851".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// BaseURL returns the server URL the client was created with.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// ListMessages returns received messages matching f, newest first.
+func (c *Client) ListMessages(ctx context.Context, f ListFilter) ([]Message, error) {
+	var messages []Message
+	if err := c.do(ctx, http.MethodGet, "/api/messages?"+f.values().Encode(), nil, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetMessage returns a single message by its database ID.
+func (c *Client) GetMessage(ctx context.Context, id int64) (*Message, error) {
+	var m Message
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/messages/%d", id), nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Ack marks a message as processed.
+func (c *Client) Ack(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/messages/%d/processed", id), nil, nil)
+}
+
+// Unack marks a message as unprocessed.
+func (c *Client) Unack(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/messages/%d/processed", id), nil, nil)
+}
+
+// AckAll marks every unprocessed message as processed and returns how many
+// were updated.
+func (c *Client) AckAll(ctx context.Context) (int64, error) {
+	var resp struct {
+		Count int64 `json:"count"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/messages/processed", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// Send sends an SMS through the server's gateway.
+func (c *Client) Send(ctx context.Context, req SendRequest) (*SendResult, error) {
+	var res SendResult
+	if err := c.do(ctx, http.MethodPost, "/api/send", req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Health returns the server's health report.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	if err := c.do(ctx, http.MethodGet, "/api/health", nil, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Ping checks that the server is answering, without touching the store or
+// the gateway.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/healthz", nil, nil)
+}
+
+// MessageState returns the delivery state of a message sent with Send.
+func (c *Client) MessageState(ctx context.Context, id string) (*MessageState, error) {
+	var m MessageState
+	if err := c.do(ctx, http.MethodGet, "/api/send/"+url.PathEscape(id), nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// HealthHistory returns the gateway health recorded between since and
+// until. Zero times are left to the server's defaults: the last 7 days.
+func (c *Client) HealthHistory(ctx context.Context, since, until time.Time) (*HealthHistory, error) {
+	v := url.Values{}
+	if !since.IsZero() {
+		v.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		v.Set("until", until.UTC().Format(time.RFC3339))
+	}
+	var h HealthHistory
+	if err := c.do(ctx, http.MethodGet, "/api/health/history?"+v.Encode(), nil, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("reaching pidge server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newAPIError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+func (f ListFilter) values() url.Values {
+	v := url.Values{}
+	if f.Phone != "" {
+		v.Set("phone", f.Phone)
+	}
+	if f.DeviceID != "" {
+		v.Set("device", f.DeviceID)
+	}
+	if f.SimNumber > 0 {
+		v.Set("sim", strconv.Itoa(f.SimNumber))
+	}
+	if f.Since != nil {
+		v.Set("since", f.Since.UTC().Format(time.RFC3339))
+	}
+	if f.Before != nil {
+		v.Set("before", f.Before.UTC().Format(time.RFC3339))
+	}
+	if f.Processed != nil {
+		v.Set("processed", strconv.FormatBool(*f.Processed))
+	}
+	if f.Limit > 0 {
+		v.Set("limit", strconv.Itoa(f.Limit))
+	}
+	if f.Offset > 0 {
+		v.Set("offset", strconv.Itoa(f.Offset))
+	}
+	if f.Ascending {
+		v.Set("order", "asc")
+	}
+	return v
+}
@@ -0,0 +1,99 @@
+package pidgeclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListMessagesQuery(t *testing.T) {
+	since := time.Date(2026, 10, 18, 14, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	before := since.Add(time.Hour)
+	processed := false
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   string
+	}{
+		{"zero values omitted", ListFilter{}, ""},
+		{
+			"every field",
+			ListFilter{
+				Phone:     "+15551234567",
+				DeviceID:  "dev1",
+				SimNumber: 2,
+				Since:     &since,
+				Before:    &before,
+				Processed: &processed,
+				Limit:     10,
+				Offset:    20,
+				Ascending: true,
+			},
+			"before=2026-10-18T13%3A30%3A00Z&device=dev1&limit=10&offset=20&order=asc" +
+				"&phone=%2B15551234567&processed=false&sim=2&since=2026-10-18T12%3A30%3A00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/messages" {
+					t.Errorf("path = %q, want /api/messages", r.URL.Path)
+				}
+				got = r.URL.RawQuery
+				w.Write([]byte("[]"))
+			}))
+			defer srv.Close()
+
+			if _, err := New(srv.URL).ListMessages(context.Background(), tt.filter); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("query = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	tests := []struct {
+		status  int
+		body    string
+		target  error
+		message string
+	}{
+		{http.StatusNotFound, `{"error":"message not found"}`, ErrNotFound, "message not found"},
+		{http.StatusUnauthorized, "Unauthorized\n", ErrUnauthorized, "Unauthorized"},
+		{http.StatusBadGateway, `{"error":"gateway unreachable"}`, ErrBadGateway, "gateway unreachable"},
+		{http.StatusInternalServerError, `{"status":"error"}`, nil, `{"status":"error"}`},
+	}
+	sentinels := []error{ErrNotFound, ErrUnauthorized, ErrBadGateway}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			_, err := New(srv.URL).GetMessage(context.Background(), 1)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+				t.Errorf("APIError = %d %q, want %d %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.message)
+			}
+			for _, s := range sentinels {
+				if got := errors.Is(err, s); got != (s == tt.target) {
+					t.Errorf("errors.Is(err, %v) = %v", s, got)
+				}
+			}
+		})
+	}
+}
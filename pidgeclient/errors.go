@@ -0,0 +1,56 @@
+package pidgeclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when the requested message does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is returned when the server rejects the request's credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrBadGateway is returned when the server could not reach the SMS gateway.
+	ErrBadGateway = errors.New("gateway error")
+)
+
+// APIError is a non-2xx response from the pidge server. It matches
+// ErrNotFound, ErrUnauthorized and ErrBadGateway with errors.Is.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether the status code corresponds to target.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrBadGateway:
+		return e.StatusCode == http.StatusBadGateway
+	}
+	return false
+}
+
+func newAPIError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	msg := strings.TrimSpace(string(body))
+
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		msg = e.Error
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: msg}
+}
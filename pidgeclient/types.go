@@ -0,0 +1,202 @@
+package pidgeclient
+
+import "time"
+
+// Message is a received SMS as returned by the pidge server.
+type Message struct {
+	ID          int64     `json:"id"`
+	EventID     string    `json:"eventId"`
+	MessageID   string    `json:"messageId"`
+	DeviceID    string    `json:"deviceId"`
+	PhoneNumber string    `json:"phoneNumber"`
+	Message     string    `json:"message"`
+	SimNumber   int       `json:"simNumber"`
+	ReceivedAt  time.Time `json:"receivedAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Processed   bool      `json:"processed"`
+}
+
+// ListFilter controls which messages ListMessages returns. Zero values are
+// left to the server's defaults.
+type ListFilter struct {
+	Phone     string
+	DeviceID  string
+	SimNumber int
+	Since     *time.Time
+	Before    *time.Time
+	Processed *bool
+	Limit     int
+	Offset    int
+	// Ascending returns the oldest messages first instead of the newest.
+	Ascending bool
+}
+
+// SendRequest is the body of POST /api/send. Only Message and one of
+// PhoneNumber or PhoneNumbers are required.
+type SendRequest struct {
+	PhoneNumber  string   `json:"phoneNumber,omitempty"`
+	PhoneNumbers []string `json:"phoneNumbers,omitempty"`
+	Message      string   `json:"message"`
+	// SimNumber selects the SIM (1-3); zero uses the device default.
+	SimNumber int `json:"simNumber,omitempty"`
+	// TTL (in seconds) and ValidUntil are mutually exclusive.
+	TTL        int64      `json:"ttl,omitempty"`
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+	// Priority of 100 or more bypasses the device's send limits.
+	Priority           int    `json:"priority,omitempty"`
+	WithDeliveryReport *bool  `json:"withDeliveryReport,omitempty"`
+	DeviceID           string `json:"deviceId,omitempty"`
+	// Transliterate replaces smart quotes and accents outside GSM-7.
+	Transliterate bool `json:"transliterate,omitempty"`
+}
+
+// SendResult is the response to POST /api/send.
+type SendResult struct {
+	MessageState
+	// Segments is how many SMS the text was split into, and Encoding
+	// whether it was sent as "GSM-7" or "UCS-2".
+	Segments int    `json:"segments"`
+	Encoding string `json:"encoding"`
+}
+
+// MessageState is the gateway's view of a sent message.
+type MessageState struct {
+	ID          string               `json:"id"`
+	DeviceID    string               `json:"deviceId"`
+	State       string               `json:"state"`
+	IsHashed    bool                 `json:"isHashed"`
+	IsEncrypted bool                 `json:"isEncrypted"`
+	Recipients  []RecipientState     `json:"recipients"`
+	States      map[string]time.Time `json:"states"`
+}
+
+// RecipientState is the delivery state for one recipient of a sent message.
+type RecipientState struct {
+	PhoneNumber string  `json:"phoneNumber"`
+	State       string  `json:"state"`
+	Error       *string `json:"error,omitempty"`
+}
+
+// Health is the server's health report.
+type Health struct {
+	Status   string        `json:"status"`
+	Server   string        `json:"server"`
+	Store    StoreHealth   `json:"store"`
+	Webhooks WebhookHealth `json:"webhooks"`
+	Gateway  GatewayHealth `json:"gateway"`
+	// Settings is present when the server checks the device's settings
+	// against [gateway.settings].
+	Settings *SettingsHealth `json:"settings,omitempty"`
+}
+
+// WebhookHealth counts webhooks the server has rejected since it started.
+type WebhookHealth struct {
+	RejectedSignature int64 `json:"rejected_signature"`
+	RejectedStale     int64 `json:"rejected_stale"`
+	RejectedReplay    int64 `json:"rejected_replay"`
+}
+
+// StoreHealth summarises the server's message store.
+type StoreHealth struct {
+	Total       int    `json:"total"`
+	Unprocessed int    `json:"unprocessed"`
+	Processed   int    `json:"processed"`
+	Error       string `json:"error,omitempty"`
+}
+
+// SettingsHealth is the server's last check of the device's settings.
+type SettingsHealth struct {
+	// Status is "in_sync", "drift", "corrected" or "error".
+	Status    string           `json:"status"`
+	CheckedAt time.Time        `json:"checkedAt"`
+	Drift     []SettingsChange `json:"drift,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// SettingsChange is a device setting that differs from the desired value.
+type SettingsChange struct {
+	Key  string `json:"key"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
+}
+
+// GatewayHealth is the gateway's status as seen by the server.
+type GatewayHealth struct {
+	Status  string                  `json:"status"`
+	Version string                  `json:"version,omitempty"`
+	Checks  map[string]GatewayCheck `json:"checks,omitempty"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+// GatewayCheck is one of the gateway's own health checks, such as
+// battery:level.
+type GatewayCheck struct {
+	Description   string `json:"description,omitempty"`
+	ObservedUnit  string `json:"observedUnit,omitempty"`
+	ObservedValue int    `json:"observedValue"`
+	Status        string `json:"status"`
+}
+
+// HealthHistory is the gateway health recorded by the server over a period.
+type HealthHistory struct {
+	Summary HealthSummary  `json:"summary"`
+	Samples []HealthSample `json:"samples"`
+}
+
+// HealthSummary describes gateway health over a period.
+type HealthSummary struct {
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+	Samples int       `json:"samples"`
+	// Uptime is the percentage of samples in which the gateway was
+	// reachable and not failing.
+	Uptime  float64         `json:"uptime"`
+	Battery *BatteryHistory `json:"battery,omitempty"`
+	Outages []Outage        `json:"outages"`
+}
+
+// BatteryHistory summarises the battery:level check.
+type BatteryHistory struct {
+	First int          `json:"first"`
+	Last  int          `json:"last"`
+	Min   int          `json:"min"`
+	Max   int          `json:"max"`
+	Days  []BatteryDay `json:"days"`
+}
+
+// BatteryDay is the battery range seen on one day, in the server's time
+// zone.
+type BatteryDay struct {
+	Date    string `json:"date"`
+	Min     int    `json:"min"`
+	Max     int    `json:"max"`
+	Average int    `json:"average"`
+}
+
+// Outage is a period in which the gateway was failing or unreachable.
+type Outage struct {
+	Start time.Time `json:"start"`
+	// End is nil while the outage is ongoing.
+	End             *time.Time `json:"end,omitempty"`
+	DurationSeconds int64      `json:"durationSeconds"`
+	// Status is "fail" or "unreachable".
+	Status  string `json:"status"`
+	Samples int    `json:"samples"`
+}
+
+// HealthSample is one recorded gateway health check.
+type HealthSample struct {
+	SampledAt time.Time `json:"sampledAt"`
+	// Status is "pass", "warn", "fail" or "unreachable".
+	Status  string                 `json:"status"`
+	Version string                 `json:"version,omitempty"`
+	Checks  map[string]SampleCheck `json:"checks,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// SampleCheck is one of the gateway's checks in a HealthSample.
+type SampleCheck struct {
+	Status string `json:"status"`
+	Value  int    `json:"value"`
+	Unit   string `json:"unit,omitempty"`
+}